@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unstppbl/gowap/pkg/history"
+)
+
+// diff implements the "gowap diff" command which reports the technologies
+// added, removed or version-changed since the previous scan of a site
+func diff(args []string) int {
+	var historyPath string
+	var help, pretty bool
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.StringVar(&historyPath, "history", "", "Path to the scan history file")
+	flags.BoolVar(&pretty, "pretty", false, "Pretty print json output")
+	flags.BoolVar(&help, "h", false, "Help")
+	//nolint:errcheck
+	flags.Parse(args)
+
+	var Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage : gowap diff [options] [url]")
+		fmt.Fprintln(os.Stderr, "Compare the last scan of url (or of every site when omitted) with the previous one")
+		flags.PrintDefaults()
+	}
+
+	if help {
+		Usage()
+		return 1
+	}
+	if historyPath == "" {
+		fmt.Fprintln(os.Stderr, "You must specify the history file")
+		Usage()
+		return 1
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "Too many arguments %s", flags.Args())
+		Usage()
+		return 1
+	}
+	if _, err := os.Stat(historyPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	store, err := history.Open(historyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	sites := store.Sites()
+	if flags.NArg() == 1 {
+		sites = []string{flags.Arg(0)}
+	}
+	var diffs []*history.Diff
+	for _, site := range sites {
+		siteDiff, err := store.Diff(site)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s : %v\n", site, err)
+			return 1
+		}
+		diffs = append(diffs, siteDiff)
+	}
+
+	var res interface{} = diffs
+	if flags.NArg() == 1 {
+		res = diffs[0]
+	}
+	out, err := json.Marshal(res)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if pretty {
+		var prettyJSON bytes.Buffer
+		err = json.Indent(&prettyJSON, out, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Println(&prettyJSON)
+	} else {
+		fmt.Println(string(out))
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unstppbl/gowap/pkg/filehash"
+)
+
+// fileHashes implements the "gowap filehashes add" command which adds the
+// hashes of the static files of an unpacked release to a database
+func fileHashes(args []string) int {
+	var dbPath string
+	var help bool
+	flags := flag.NewFlagSet("filehashes", flag.ExitOnError)
+	flags.StringVar(&dbPath, "db", "", "Path to the file hashes database, created when missing")
+	flags.BoolVar(&help, "h", false, "Help")
+
+	var Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage : gowap filehashes add [options] <technology> <version> <dir> [path...]")
+		fmt.Fprintln(os.Stderr, "Hash the files at the paths (from the root of the sites) of a release of technology unpacked in dir,")
+		fmt.Fprintln(os.Stderr, "by default the files of technology already in the database")
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 || args[0] != "add" {
+		Usage()
+		return 1
+	}
+	//nolint:errcheck
+	flags.Parse(args[1:])
+	if help {
+		Usage()
+		return 1
+	}
+	if dbPath == "" {
+		fmt.Fprintln(os.Stderr, "You must specify the database file")
+		Usage()
+		return 1
+	}
+	if flags.NArg() < 3 {
+		fmt.Fprintln(os.Stderr, "You must specify the technology, its version and the directory of the release")
+		Usage()
+		return 1
+	}
+	technology, version, dir := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+	db := filehash.NewDatabase()
+	if _, err := os.Stat(dbPath); err == nil {
+		if db, err = filehash.Load(dbPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	paths := flags.Args()[3:]
+	if len(paths) == 0 {
+		for _, file := range db.Files(technology) {
+			paths = append(paths, file.Path)
+		}
+	}
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "No file of %s in the database, you must specify the paths to hash\n", technology)
+		return 1
+	}
+	if err := db.AddRelease(technology, version, dir, paths); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := db.Write(dbPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -6,29 +6,104 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	gowap "github.com/unstppbl/gowap/pkg/core"
+	scrapers "github.com/unstppbl/gowap/pkg/scraper"
 )
 
+// stringList is a flag which can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
 
-	var url, appsJSONPath, scraper, userAgent string
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(diff(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "filehashes" {
+		os.Exit(fileHashes(os.Args[2:]))
+	}
+
+	var url, appsJSONPath, scraper, userAgent, robotsMode, vulnFeedPath, historyPath, cacheMode, cacheDir, fileHashesPath string
 	var help, pretty bool
-	var timeoutSeconds, loadingTimeoutSeconds, maxDepth, maxVisitedLinks, msDelayBetweenRequests int
+	var timeoutSeconds, loadingTimeoutSeconds, maxDepth, maxVisitedLinks, msDelayBetweenRequests, cacheTTLSeconds int
+	var maxConcurrency, maxConcurrencyPerHost, requestsBurst, crawlTimeBudgetSeconds, maxSitemapURLs int
+	var sitemapSeeding, subdomains, incognito, headless, subresources, fetchScripts, noDNS, favicon, probe, insecure bool
+	var scopeSchemes, excludedExtensions, browserURL, browserBin, userDataDir, blockedTypes, blockedDomains, dnsServer string
+	var includePatterns, excludePatterns, browserFlags stringList
+	var maxQueryVariants, robotsTTLSeconds, browserPoolSize, tabMaxAgeSeconds, tabMaxUses, maxScripts, maxScriptBytes int
+	var dnsTimeoutSeconds, dnsTTLSeconds, maxProbes, maxHashedFiles int
+	var requestsPerSecond float64
 	flag.StringVar(&appsJSONPath, "file", "", "Path to override default technologies.json file")
-	flag.StringVar(&scraper, "scraper", "rod", "Choose scraper between rod (default) and colly")
+	flag.StringVar(&scraper, "scraper", "rod", "Choose scraper between "+strings.Join(scrapers.Names(), ", "))
 	flag.StringVar(&userAgent, "useragent", "", "Override the user-agent string")
+	flag.StringVar(&robotsMode, "robots", "crawled", "robots.txt policy : ignore, crawled (only for pages found while crawling) or always")
+	flag.BoolVar(&insecure, "insecure", false, "Don't verify the certificates of the servers of robots.txt, sitemaps, scripts, favicons, probes and static files")
+	flag.IntVar(&robotsTTLSeconds, "robotsttl", 86400, "Time to live in seconds of cached robots.txt files. 0 means no expiration")
 	flag.IntVar(&timeoutSeconds, "timeout", 3, "Timeout in seconds for fetching the url")
 	flag.IntVar(&loadingTimeoutSeconds, "loadtimeout", 3, "Timeout in seconds for loading the page")
 	flag.IntVar(&maxDepth, "depth", 0, "Don't analyze page when depth superior to this number. Default (0) means no recursivity (only first page will be analyzed)")
 	flag.IntVar(&maxVisitedLinks, "maxlinks", 5, "Max number of pages to visit. Exit when reached")
-	flag.IntVar(&msDelayBetweenRequests, "delay", 100, "Delay in ms between requests")
+	flag.IntVar(&msDelayBetweenRequests, "delay", 100, "Minimum delay in ms between two requests to the same host")
+	flag.IntVar(&maxConcurrency, "concurrency", 4, "Max number of pages analyzed at the same time by concurrent scrapers (colly)")
+	flag.IntVar(&maxConcurrencyPerHost, "hostconcurrency", 2, "Max number of pages of the same host analyzed at the same time by concurrent scrapers (colly)")
+	flag.Float64Var(&requestsPerSecond, "rps", 0, "Max number of requests per second to the same host. Default (0) means no limit")
+	flag.IntVar(&requestsBurst, "burst", 1, "Number of requests to the same host allowed at once above the rps limit")
+	flag.IntVar(&crawlTimeBudgetSeconds, "budget", 0, "Time budget in seconds of the crawl, no page is started once spent. Default (0) means no limit")
+	flag.BoolVar(&sitemapSeeding, "sitemap", false, "Also crawl the pages listed in the sitemaps of the site (robots.txt Sitemap lines and /sitemap.xml) when depth > 0")
+	flag.IntVar(&maxSitemapURLs, "maxsitemapurls", 1000, "Max number of pages read from the sitemaps")
+	flag.Var(&includePatterns, "include", "Only crawl links matching this regex (can be repeated)")
+	flag.Var(&excludePatterns, "exclude", "Don't crawl links matching this regex, e.g. logout (can be repeated)")
+	flag.BoolVar(&subdomains, "subdomains", false, "Also crawl links to the other hosts of the registrable domain of the url (cdn.example.co.uk for shop.example.co.uk)")
+	flag.StringVar(&scopeSchemes, "schemes", "http,https", "Comma separated schemes of the links to crawl")
+	flag.IntVar(&maxQueryVariants, "queryvariants", 0, "Max number of query strings crawled per path. Default (0) means query strings are dropped")
+	flag.StringVar(&excludedExtensions, "excludeext", strings.Join(gowap.NewConfig().ScopeExcludedExtensions, ","), "Comma separated file extensions of the links not to crawl")
+	flag.StringVar(&browserURL, "browserurl", "", "DevTools URL (ws://... or host:port) of a running browser to use instead of launching one (rod)")
+	flag.StringVar(&browserBin, "browserbin", "", "Path of the browser binary to launch (rod)")
+	flag.StringVar(&userDataDir, "userdatadir", "", "User data directory of the launched browser, kept once done (rod)")
+	flag.Var(&browserFlags, "browserflag", "Command line flag of the launched browser, e.g. --window-size=1920,1080 (can be repeated)")
+	flag.BoolVar(&headless, "headless", true, "Launch the browser without window, -headless=false shows it (rod)")
+	flag.IntVar(&browserPoolSize, "tabs", 2, "Number of idle browser tabs kept for reuse (rod)")
+	flag.IntVar(&tabMaxAgeSeconds, "tabmaxage", 300, "Max age in seconds of a reused browser tab (rod). 0 means no limit")
+	flag.IntVar(&tabMaxUses, "tabmaxuses", 50, "Max number of pages scraped by a browser tab (rod). 0 means no limit")
+	flag.BoolVar(&incognito, "incognito", false, "Give each browser tab its own incognito context (rod)")
+	flag.StringVar(&blockedTypes, "blocktypes", "", "Comma separated resource types not loaded by the browser, e.g. Image,Media,Font,Stylesheet (rod)")
+	flag.StringVar(&blockedDomains, "blockdomains", "", "Comma separated domains (and their subdomains) not loaded by the browser (rod)")
+	flag.BoolVar(&subresources, "subresources", false, "Also match headers and cookies of the subresources (scripts, API calls, ...) from the same site (rod)")
+	flag.BoolVar(&fetchScripts, "scripts", false, "Download the scripts of the pages to match their contents")
+	flag.IntVar(&maxScripts, "maxscripts", 20, "Max number of scripts downloaded per page")
+	flag.IntVar(&maxScriptBytes, "maxscriptsize", 512*1024, "Max size in bytes of a downloaded script")
+	flag.BoolVar(&noDNS, "nodns", false, "Don't look up the DNS records of the pages")
+	flag.BoolVar(&favicon, "favicon", false, "Download the icon of the pages to match its MD5 and mmh3 hashes")
+	flag.BoolVar(&probe, "probe", false, "Request the well-known paths of the probes rules (/wp-login.php, /server-status, ...) at the root of the site")
+	flag.IntVar(&maxProbes, "maxprobes", 10, "Max number of paths probed per scan")
+	flag.StringVar(&dnsServer, "dnsserver", "", "DNS server (host or host:port) to query instead of the system resolver")
+	flag.IntVar(&dnsTimeoutSeconds, "dnstimeout", 2, "Timeout in seconds of a DNS query")
+	flag.IntVar(&dnsTTLSeconds, "dnsttl", 300, "Time to live in seconds of cached DNS records. 0 means no expiration")
+	flag.StringVar(&fileHashesPath, "filehashes", "", "Path to a database of static file hashes narrowing the versions of the detected technologies")
+	flag.IntVar(&maxHashedFiles, "maxhashedfiles", 5, "Max number of static files hashed per detected technology")
+	flag.StringVar(&vulnFeedPath, "vulnfeed", "", "Path to a local NVD JSON feed, compact index or directory of feeds to flag vulnerable versions")
+	flag.StringVar(&historyPath, "history", "", "Path to the scan history file in which results are recorded (see gowap diff)")
+	flag.StringVar(&cacheMode, "cache", "", "Cache scraped pages on disk : readwrite, record (always scrape) or replay (no network)")
+	flag.StringVar(&cacheDir, "cachedir", "gowap-cache", "Directory of the scraped pages cache")
+	flag.IntVar(&cacheTTLSeconds, "cachettl", 0, "Time to live in seconds of cached pages. Default (0) means no expiration")
 	flag.BoolVar(&pretty, "pretty", false, "Pretty print json output")
 	flag.BoolVar(&help, "h", false, "Help")
 	flag.Parse()
 
 	var Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage : gowap [options] <url>")
+		fmt.Fprintln(os.Stderr, "        gowap diff [options] [url]")
+		fmt.Fprintln(os.Stderr, "        gowap filehashes add [options] <technology> <version> <dir> [path...]")
 		flag.PrintDefaults()
 	}
 
@@ -47,8 +122,8 @@ func main() {
 	} else {
 		url = flag.Arg(0)
 	}
-	if scraper != "rod" && scraper != "colly" {
-		fmt.Fprintf(os.Stderr, "Unknown scraper %s : only supporting rod and colly", scraper)
+	if !knownScraper(scraper) {
+		fmt.Fprintf(os.Stderr, "Unknown scraper %s : only supporting %s", scraper, strings.Join(scrapers.Names(), ", "))
 		Usage()
 		os.Exit(1)
 	}
@@ -60,7 +135,52 @@ func main() {
 	config.MaxDepth = maxDepth
 	config.MaxVisitedLinks = maxVisitedLinks
 	config.MsDelayBetweenRequests = msDelayBetweenRequests
+	config.MaxConcurrency = maxConcurrency
+	config.MaxConcurrencyPerHost = maxConcurrencyPerHost
+	config.RequestsPerSecond = requestsPerSecond
+	config.RequestsBurst = requestsBurst
+	config.CrawlTimeBudgetSeconds = crawlTimeBudgetSeconds
+	config.SitemapSeeding = sitemapSeeding
+	config.MaxSitemapURLs = maxSitemapURLs
+	config.ScopeIncludePatterns = includePatterns
+	config.ScopeExcludePatterns = excludePatterns
+	config.ScopeSubdomains = subdomains
+	config.ScopeSchemes = splitList(scopeSchemes)
+	config.ScopeMaxQueryVariants = maxQueryVariants
+	config.ScopeExcludedExtensions = splitList(excludedExtensions)
 	config.Scraper = scraper
+	config.VulnFeedPath = vulnFeedPath
+	config.FileHashesPath = fileHashesPath
+	config.MaxHashedFiles = maxHashedFiles
+	config.HistoryPath = historyPath
+	config.CacheMode = cacheMode
+	config.CacheDir = cacheDir
+	config.CacheTTLSeconds = cacheTTLSeconds
+	config.BrowserControlURL = browserURL
+	config.BrowserBinPath = browserBin
+	config.BrowserUserDataDir = userDataDir
+	config.BrowserFlags = browserFlags
+	config.BrowserHeadless = headless
+	config.BrowserPoolSize = browserPoolSize
+	config.BrowserTabMaxAgeSeconds = tabMaxAgeSeconds
+	config.BrowserTabMaxUses = tabMaxUses
+	config.BrowserIncognito = incognito
+	config.BlockedResourceTypes = splitList(blockedTypes)
+	config.BlockedDomains = splitList(blockedDomains)
+	config.MatchSubresources = subresources
+	config.FetchScripts = fetchScripts
+	config.MaxScripts = maxScripts
+	config.MaxScriptBytes = maxScriptBytes
+	config.DNSDisabled = noDNS
+	config.DNSServer = dnsServer
+	config.DNSTimeoutSeconds = dnsTimeoutSeconds
+	config.DNSCacheTTLSeconds = dnsTTLSeconds
+	config.FaviconDetection = favicon
+	config.ActiveProbing = probe
+	config.MaxProbes = maxProbes
+	config.RobotsMode = robotsMode
+	config.RobotsTTLSeconds = robotsTTLSeconds
+	config.InsecureSkipVerify = insecure
 	if userAgent != "" {
 		config.UserAgent = userAgent
 	}
@@ -71,6 +191,9 @@ func main() {
 		os.Exit(1)
 	}
 	res, err := wapp.Analyze(url)
+	if closeErr := wapp.Close(); closeErr != nil {
+		fmt.Fprintln(os.Stderr, closeErr)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -87,3 +210,24 @@ func main() {
 
 	}
 }
+
+// knownScraper tells whether a scraper is registered under name
+func knownScraper(name string) bool {
+	for _, registered := range scrapers.Names() {
+		if registered == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated flag value
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
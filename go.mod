@@ -19,6 +19,7 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/temoto/robotstxt v1.1.2
 	go.zoe.im/surferua v0.0.3
+	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
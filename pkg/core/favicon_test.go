@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// Hashes of testdata/favicon/favicon.ico, computed with Python :
+// hashlib.md5(icon) and mmh3.hash(base64.encodebytes(icon))
+const (
+	fixtureFaviconMD5  = "a4bbaf2af2e78d5d7d7f1cfd636d6ad7"
+	fixtureFaviconMMH3 = "-931075177"
+)
+
+func TestFaviconHashes(t *testing.T) {
+	assert.Equal(t, int32(-156908512), int32(murmur3([]byte("foo"), 0)))
+	assert.Equal(t, int32(613153351), int32(murmur3([]byte("hello"), 0)))
+	assert.Equal(t, uint32(0), murmur3(nil, 0))
+
+	icon, err := ioutil.ReadFile("testdata/favicon/favicon.ico")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, fixtureFaviconMMH3, fmt.Sprint(faviconMMH3(icon)))
+}
+
+func Test_faviconURL(t *testing.T) {
+	pages := map[string]string{
+		`<html><head></head></html>`: "https://example.com/favicon.ico",
+		`<link rel="stylesheet" href="/app.css"><link rel="Shortcut Icon" href="/static/icon.png">`: "https://example.com/static/icon.png",
+		`<base href="https://cdn.example.com/assets/"><link rel="icon" href="favicon.svg">`:         "https://cdn.example.com/assets/favicon.svg",
+		`<link rel="icon" href="data:image/png;base64,iVBORw0KGgo="><link rel="icon" href="i.ico">`: "https://example.com/blog/i.ico",
+		`<link rel="apple-touch-icon" href="/apple.png">`:                                           "https://example.com/favicon.ico",
+	}
+	for html, expected := range pages {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, faviconURL(doc, "https://example.com/blog/post"), html)
+		}
+	}
+	assert.Equal(t, "https://example.com/favicon.ico", faviconURL(nil, "https://example.com/blog/post"))
+}
+
+func TestFavicon(t *testing.T) {
+	icon, err := ioutil.ReadFile("testdata/favicon/favicon.ico")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var iconRequests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><link rel="shortcut icon" href="/static/icon.ico"></head><body><a href="/about">About</a></body></html>`)
+		case "/about":
+			fmt.Fprint(w, `<html><head><link rel="icon" href="/static/icon.ico"></head></html>`)
+		case "/static/icon.ico":
+			atomic.AddInt32(&iconRequests, 1)
+			w.Header().Set("Content-Type", "image/x-icon")
+			w.Write(icon)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	technologies := []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Acme CMS":{"cats":[1],"favicon":"` + fixtureFaviconMMH3 + `\\;version:2.0"},
+		"Acme Admin":{"cats":[1],"favicon":["0123456789abcdef0123456789abcdef","` + strings.ToUpper(fixtureFaviconMD5) + `\\;confidence:50"]},
+		"Other":{"cats":[1],"favicon":"116323821"}}}`)
+
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.FaviconDetection = true
+	config.MaxDepth = 1
+	config.DNSDisabled = true
+	config.RobotsMode = "ignore"
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	assert.NotNil(t, wapp.Apps["Jenkins"].Favicon, "The starter set should be added to the included technologies")
+	if !assert.NoError(t, parseTechnologiesFile(&technologies, wapp), "Technologies parsing error") {
+		return
+	}
+	res, err := wapp.Analyze(ts.URL)
+	if assert.NoError(t, err, "GoWap Analyze error") {
+		var output output
+		err = json.UnmarshalFromString(res.(string), &output)
+		if assert.NoError(t, err, "Unmarshal error") {
+			found := make(map[string]technology)
+			for _, v := range output.Technologies {
+				found[v.Name] = v
+			}
+			assert.Equal(t, []string{"Acme Admin", "Acme CMS"}, sortedKeys(found))
+			assert.Equal(t, "2.0", found["Acme CMS"].Version)
+			assert.Equal(t, 50, found["Acme Admin"].Confidence)
+			assert.Equal(t, []string{"favicon " + ts.URL + "/static/icon.ico"}, found["Acme CMS"].Evidence)
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&iconRequests), "The icon should be downloaded once")
+}
+
+func sortedKeys(found map[string]technology) []string {
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"net/url"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/unstppbl/gowap/pkg/filehash"
+	scraper "github.com/unstppbl/gowap/pkg/scraper"
+)
+
+// maxHashedFileBytes is the max size of a downloaded static file
+const maxHashedFileBytes = 2 * 1024 * 1024
+
+// hashFiles narrows the versions of the detected technologies from the
+// hashes of their static files at the root of the site of paramURL : at
+// most MaxHashedFiles files per technology are downloaded, until a single
+// version is left. The versions shipping each known file are recorded as
+// evidence, and narrow the version of the technology.
+func (c *crawler) hashFiles(paramURL string) {
+	site, err := url.Parse(paramURL)
+	if err != nil || site.Host == "" || c.wapp.Fetcher == nil || c.wapp.Config.CacheMode == scraper.CacheReplay {
+		return
+	}
+	c.detected.Mu.Lock()
+	names := make([]string, 0, len(c.detected.Apps))
+	for name := range c.detected.Apps {
+		if len(c.wapp.FileHashes.Files(name)) > 0 {
+			names = append(names, name)
+		}
+	}
+	c.detected.Mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		var ranges []filehash.Range
+		var evidence []string
+		files := c.wapp.FileHashes.Files(name)
+		if len(files) > c.wapp.Config.MaxHashedFiles {
+			files = files[:c.wapp.Config.MaxHashedFiles]
+		}
+		for _, file := range files {
+			fileURL := &url.URL{Scheme: site.Scheme, Host: site.Host, Path: file.Path}
+			resource, err := c.fetchSitePath(site, file.Path, maxHashedFileBytes)
+			if err != nil && c.ctx.Err() != nil {
+				log.Printf("Crawl time budget spent before hashing %s", fileURL)
+				return
+			} else if err != nil {
+				log.Debugf("Couldn't hash %s : %v", fileURL, err)
+				continue
+			} else if resource.Status != 200 {
+				log.Debugf("Couldn't hash %s : status %d", fileURL, resource.Status)
+				continue
+			}
+			versions := file.Versions(filehash.Hash(resource.Body))
+			if len(versions) == 0 {
+				continue
+			}
+			narrowed := versions
+			if ranges != nil {
+				narrowed = filehash.Intersect(ranges, versions)
+			}
+			if len(narrowed) == 0 {
+				log.Warnf("Hash of %s doesn't match the versions of %s found with the other files", fileURL, name)
+				continue
+			}
+			ranges = narrowed
+			evidence = append(evidence, "hash of "+fileURL.String()+" : "+joinRanges(versions))
+			if _, ok := filehash.Single(ranges); ok {
+				break
+			}
+		}
+		c.narrowVersion(name, ranges, evidence)
+	}
+}
+
+// narrowVersion adds the evidence to the detected technology name, and
+// narrows its version with ranges. The version found by the patterns may be
+// coarse ("3" for 3.2.5), it is a prefix of the version : it is replaced by
+// the single version of ranges with this prefix, or by the longer prefix of
+// these ranges, and kept when the hashes contradict it. Ranges are reported
+// in the evidence when they hold several versions.
+func (c *crawler) narrowVersion(name string, ranges []filehash.Range, evidence []string) {
+	if len(evidence) == 0 {
+		return
+	}
+	c.detected.Mu.Lock()
+	defer c.detected.Mu.Unlock()
+	found, ok := c.detected.Apps[name]
+	if !ok {
+		return
+	}
+	found.technology.Evidence = append(found.technology.Evidence, evidence...)
+	detectedVersion := found.technology.Version
+	if detectedVersion == "" {
+		if version, ok := filehash.Single(ranges); ok {
+			found.technology.Version = version
+		} else {
+			found.technology.Evidence = append(found.technology.Evidence, "versions from file hashes : "+joinRanges(ranges))
+		}
+		return
+	}
+	matching := filehash.WithPrefix(ranges, detectedVersion)
+	if len(matching) == 0 {
+		log.Infof("Version %s of %s doesn't match the hashes of its files, kept", detectedVersion, name)
+		found.technology.Evidence = append(found.technology.Evidence, "versions from file hashes : "+joinRanges(ranges))
+		return
+	}
+	if version, ok := filehash.Single(matching); ok {
+		found.technology.Version = version
+		return
+	}
+	if prefix := filehash.CommonPrefix(matching); len(prefix) > len(detectedVersion) {
+		found.technology.Version = prefix
+	}
+	found.technology.Evidence = append(found.technology.Evidence, "versions from file hashes : "+joinRanges(matching))
+}
+
+// joinRanges formats ranges as "1.2.0 - 1.2.5, 1.3.1"
+func joinRanges(ranges []filehash.Range) (joined string) {
+	for i, r := range ranges {
+		if i > 0 {
+			joined += ", "
+		}
+		joined += r.String()
+	}
+	return joined
+}
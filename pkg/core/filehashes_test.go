@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unstppbl/gowap/pkg/filehash"
+)
+
+func TestFileHashes(t *testing.T) {
+	files := map[string]string{
+		"/static/acme.js":  "/*! acme */ var acme = {};",
+		"/static/acme.css": ".acme { color: red; }",
+		"/static/acme.svg": "<svg></svg>",
+		"/static/other.js": "var other = {};",
+	}
+	var lock sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		if content, ok := files[r.URL.Path]; ok {
+			fmt.Fprint(w, content)
+		} else if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><body>Powered by acme</body></html>`)
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "filehashes")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	hashes := fmt.Sprintf(`{"technologies":{
+		"Acme":[
+			{"path":"/static/missing.js","hashes":{"00":["1.0"]}},
+			{"path":"/static/acme.js","hashes":{"%s":["2.0 - 2.3"],"11":["2.4"]}},
+			{"path":"/static/acme.css","hashes":{"%s":["1.0 - 1.9","2.3 - 2.4"]}},
+			{"path":"/static/acme.svg","hashes":{"%s":["2.3"]}}],
+		"Other":[{"path":"/static/other.js","hashes":{"%s":["1.0"]}}]}}`,
+		filehash.Hash([]byte(files["/static/acme.js"])), filehash.Hash([]byte(files["/static/acme.css"])),
+		filehash.Hash([]byte(files["/static/acme.svg"])), filehash.Hash([]byte(files["/static/other.js"])))
+	hashesPath := filepath.Join(dir, "hashes.json")
+	if !assert.NoError(t, ioutil.WriteFile(hashesPath, []byte(hashes), 0644)) {
+		return
+	}
+	technologies := []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Acme":{"cats":[1],"html":"Powered by acme"},
+		"Other":{"cats":[1],"html":"Powered by other"}}}`)
+
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.FileHashesPath = hashesPath
+	config.DNSDisabled = true
+	config.RobotsMode = "ignore"
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	if !assert.NoError(t, parseTechnologiesFile(&technologies, wapp), "Technologies parsing error") {
+		return
+	}
+	res, err := wapp.Analyze(ts.URL)
+	if assert.NoError(t, err, "GoWap Analyze error") {
+		var output output
+		err = json.UnmarshalFromString(res.(string), &output)
+		if assert.NoError(t, err, "Unmarshal error") && assert.Len(t, output.Technologies, 1) {
+			acme := output.Technologies[0]
+			assert.Equal(t, "2.3", acme.Version)
+			assert.Equal(t, []string{
+				"hash of " + ts.URL + "/static/acme.js : 2.0 - 2.3",
+				"hash of " + ts.URL + "/static/acme.css : 1.0 - 1.9, 2.3 - 2.4",
+			}, acme.Evidence)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 0, requests["/static/acme.svg"], "No file should be hashed once the version is found")
+	assert.Equal(t, 0, requests["/static/other.js"], "Only the files of detected technologies should be hashed")
+
+	config.FileHashesPath = filepath.Join(dir, "missing.json")
+	_, err = Init(config)
+	assert.Error(t, err, "A missing database should fail")
+}
+
+func TestNarrowVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		detected string
+		ranges   []string
+		version  string
+		evidence []string
+	}{
+		{"Fitting version is kept", "2.1", []string{"2.0 - 2.3"}, "2.1", []string{"versions from file hashes : 2.0 - 2.3"}},
+		{"Single version is set", "", []string{"2.3"}, "2.3", nil},
+		{"Imprecise version is narrowed", "2", []string{"2.3", "3.0"}, "2.3", nil},
+		{"Imprecise version is narrowed to the prefix of the ranges", "3", []string{"3.2.0 - 3.2.5"}, "3.2", []string{"versions from file hashes : 3.2.0 - 3.2.5"}},
+		{"Imprecise version is kept", "3", []string{"3.0 - 3.1", "3.2.0 - 3.2.5", "4.0"}, "3", []string{"versions from file hashes : 3.0 - 3.1, 3.2.0 - 3.2.5"}},
+		{"Ranges are reported", "", []string{"2.0 - 2.3", "3.0"}, "", []string{"versions from file hashes : 2.0 - 2.3, 3.0"}},
+		{"Contradicted version is kept", "1.0", []string{"2.3"}, "1.0", []string{"versions from file hashes : 2.3"}},
+		{"Contradicted version is kept with the ranges", "1.0", []string{"2.0 - 2.3"}, "1.0", []string{"versions from file hashes : 2.0 - 2.3"}},
+	}
+	for _, tt := range tests {
+		c := &crawler{detected: &detected{new(sync.Mutex), map[string]*resultApp{
+			"Acme": {technology: technology{Name: "Acme", Version: tt.detected}},
+		}}}
+		var ranges []filehash.Range
+		for _, s := range tt.ranges {
+			r, _ := filehash.ParseRange(s)
+			ranges = append(ranges, r)
+		}
+		c.narrowVersion("Acme", ranges, []string{"hash of /acme.js"})
+		technology := c.detected.Apps["Acme"].technology
+		assert.Equal(t, tt.version, technology.Version, tt.name)
+		assert.Equal(t, append([]string{"hash of /acme.js"}, tt.evidence...), technology.Evidence, tt.name)
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	hexSegment     = regexp.MustCompile(`^[0-9a-fA-F-]{8,}$`)
+	slugSegment    = regexp.MustCompile(`^[\w%]+(?:[-_+][\w%]+){2,}$`)
+	idLikeSegment  = regexp.MustCompile(`^[a-zA-Z]*\d+[\w-]*$`)
+)
+
+// pathTemplate reduces an URL to the structure of its path : numbers,
+// hashes, slugs and identifiers are replaced by placeholders, so that
+// /blog/2021/09/my-first-post and /blog/2020/01/another-long-title share
+// the template /blog/{n}/{n}/{slug}
+func pathTemplate(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		ext := ""
+		if dot := strings.LastIndex(segment, "."); dot > 0 {
+			segment, ext = segment[:dot], segment[dot:]
+		}
+		switch {
+		case numericSegment.MatchString(segment):
+			segment = "{n}"
+		case hexSegment.MatchString(segment) && strings.ContainsAny(segment, "0123456789"):
+			segment = "{hash}"
+		case slugSegment.MatchString(segment):
+			segment = "{slug}"
+		case idLikeSegment.MatchString(segment):
+			segment = "{id}"
+		}
+		segments[i] = segment + ext
+	}
+	return u.Host + "/" + strings.Join(segments, "/")
+}
+
+// prioritizeURLs orders urls so that every path template is visited once
+// before any template is visited again, spending the MaxVisitedLinks budget
+// on structurally different pages. Shorter templates come first, and the
+// order is deterministic.
+func prioritizeURLs(urls map[string]struct{}) []string {
+	groups := make(map[string][]string)
+	var templates []string
+	for u := range urls {
+		template := pathTemplate(u)
+		if _, ok := groups[template]; !ok {
+			templates = append(templates, template)
+		}
+		groups[template] = append(groups[template], u)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		depthI, depthJ := strings.Count(templates[i], "/"), strings.Count(templates[j], "/")
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return templates[i] < templates[j]
+	})
+	for _, group := range groups {
+		sort.Strings(group)
+	}
+
+	ordered := make([]string, 0, len(urls))
+	for round := 0; len(ordered) < len(urls); round++ {
+		for _, template := range templates {
+			if round < len(groups[template]) {
+				ordered = append(ordered, groups[template][round])
+			}
+		}
+	}
+	return ordered
+}
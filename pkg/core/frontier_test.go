@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pathTemplate(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com", "example.com/"},
+		{"https://example.com/about", "example.com/about"},
+		{"https://example.com/blog/2021/09/my-first-post", "example.com/blog/{n}/{n}/{slug}"},
+		{"https://example.com/blog/2020/01/another-long-title/", "example.com/blog/{n}/{n}/{slug}"},
+		{"https://example.com/product/1234.html", "example.com/product/{n}.html"},
+		{"https://example.com/u/5f2b9c1e-7a3d-4c1b-9e2f-0a1b2c3d4e5f", "example.com/u/{hash}"},
+		{"https://example.com/page2", "example.com/{id}"},
+		{"https://example.com/contact-us", "example.com/contact-us"},
+		{"https://example.com/static/app.3f2a9c1d.js", "example.com/static/app.3f2a9c1d.js"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, pathTemplate(tt.url), "pathTemplate(%s)", tt.url)
+	}
+}
+
+func Test_prioritizeURLs(t *testing.T) {
+	urls := map[string]struct{}{
+		"https://example.com/blog/how-to-scan-a-site":   {},
+		"https://example.com/blog/why-we-love-go-a-lot": {},
+		"https://example.com/blog/the-third-blog-post":  {},
+		"https://example.com/about":                     {},
+		"https://example.com/products/12":               {},
+		"https://example.com/products/13":               {},
+	}
+	assert.Equal(t, []string{
+		"https://example.com/about",
+		"https://example.com/blog/how-to-scan-a-site",
+		"https://example.com/products/12",
+		"https://example.com/blog/the-third-blog-post",
+		"https://example.com/products/13",
+		"https://example.com/blog/why-we-love-go-a-lot",
+	}, prioritizeURLs(urls))
+}
+
+func TestSitemapSeeding(t *testing.T) {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		var sitemap strings.Builder
+		sitemap.WriteString(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(&sitemap, "<url><loc>%s/blog/my-blog-post-number-%d</loc></url>", ts.URL, i)
+		}
+		fmt.Fprintf(&sitemap, "<url><loc>%s/about</loc></url><url><loc>%s/contact</loc></url>", ts.URL, ts.URL)
+		fmt.Fprintf(&sitemap, "<url><loc>https://elsewhere.com/about</loc></url></urlset>")
+		fmt.Fprint(w, sitemap.String())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>No links here</body></html>")
+	})
+	ts = httptest.NewServer(mux)
+	defer ts.Close()
+
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.MaxDepth = 1
+	config.MaxVisitedLinks = 4
+	config.SitemapSeeding = true
+	wapp, err := Init(config)
+	if assert.NoError(t, err, "GoWap Init error") {
+		res, err := wapp.Analyze(ts.URL)
+		if assert.NoError(t, err, "GoWap Analyze error") {
+			var output output
+			err = json.UnmarshalFromString(res.(string), &output)
+			if assert.NoError(t, err, "Unmarshal error") {
+				var visited []string
+				for _, u := range output.URLs {
+					visited = append(visited, strings.TrimPrefix(u.URL, ts.URL))
+				}
+				assert.ElementsMatch(t, []string{"", "/about", "/contact", "/blog/my-blog-post-number-0"}, visited, "Budget should be spent on different page structures")
+			}
+		}
+	}
+}
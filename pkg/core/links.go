@@ -0,0 +1,96 @@
+package core
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/unstppbl/gowap/pkg/urlnorm"
+)
+
+// followedRels are the rel values of <link> elements pointing to pages
+var followedRels = map[string]struct{}{
+	"alternate": {},
+	"canonical": {},
+	"next":      {},
+	"prev":      {},
+	"previous":  {},
+}
+
+var refreshURLRegex = regexp.MustCompile(`(?i)^\s*\d+(?:\.\d*)?\s*[;,]\s*(?:url\s*=\s*)?['"]?([^'"\s]+)`)
+
+// linkSources are the elements and attributes holding links to pages
+var linkSources = []struct {
+	selector string
+	attr     string
+}{
+	{"a[href]", "href"},
+	{"area[href]", "href"},
+	{"iframe[src]", "src"},
+	{"frame[src]", "src"},
+}
+
+// documentBase returns the URL relative links of doc are resolved against :
+// its first <base href>, otherwise pageURL
+func documentBase(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		// Not normalized : the trailing slash matters to resolve relative links
+		if baseURL, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			if baseURL = pageURL.ResolveReference(baseURL); baseURL.Host != "" {
+				return baseURL
+			}
+		}
+	}
+	return pageURL
+}
+
+// getLinksSlice parses query doc and return the normalized links to pages,
+// the crawl scope decides which ones are followed. currentURL is the URL the
+// page was served from, after redirects.
+func getLinksSlice(doc *goquery.Document, currentURL string) *map[string]struct{} {
+	ret := make(map[string]struct{})
+	base, err := url.Parse(currentURL)
+	if err != nil {
+		return &ret
+	}
+	base = documentBase(doc, base)
+
+	add := func(rawLink string) {
+		link, err := urlnorm.Normalize(base, rawLink)
+		if err != nil || link.Host == "" || (link.Scheme != "http" && link.Scheme != "https") {
+			return
+		}
+		ret[link.String()] = struct{}{}
+	}
+
+	for _, source := range linkSources {
+		doc.Find(source.selector).Each(func(index int, item *goquery.Selection) {
+			add(item.AttrOr(source.attr, ""))
+		})
+	}
+	doc.Find("link[href][rel]").Each(func(index int, item *goquery.Selection) {
+		for _, rel := range strings.Fields(strings.ToLower(item.AttrOr("rel", ""))) {
+			if _, ok := followedRels[rel]; ok {
+				add(item.AttrOr("href", ""))
+				return
+			}
+		}
+	})
+	// Forms sent with GET lead to pages, an empty action is the current page
+	doc.Find("form").Each(func(index int, item *goquery.Selection) {
+		if method := strings.ToLower(item.AttrOr("method", "get")); method == "get" {
+			if action := item.AttrOr("action", ""); action != "" {
+				add(action)
+			}
+		}
+	})
+	doc.Find("meta[http-equiv][content]").Each(func(index int, item *goquery.Selection) {
+		if strings.EqualFold(item.AttrOr("http-equiv", ""), "refresh") {
+			if match := refreshURLRegex.FindStringSubmatch(item.AttrOr("content", "")); match != nil {
+				add(match[1])
+			}
+		}
+	})
+	return &ret
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	scraper "github.com/unstppbl/gowap/pkg/scraper"
+)
+
+// maxProbeBytes is the max size of the body of a probe response
+const maxProbeBytes = 256 * 1024
+
+// probe is a request to a well-known path of the site (/wp-login.php,
+// /server-status, ...). It matches when the response has the expected
+// status (200 by default) and its body and headers match the patterns,
+// which can extract the version as the other patterns do.
+type probe struct {
+	Path       string            `json:"path"`
+	Status     int               `json:"status,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Confidence int               `json:"confidence,omitempty"`
+}
+
+type probedApp struct {
+	app   *application
+	probe *probe
+}
+
+// probe requests the probed paths of the technologies at the root of the
+// site of paramURL, at most MaxProbes of them : the paths of the detected
+// technologies first, which probes can confirm or version, then the others
+// in alphabetical order. Probes are spaced as the pages of the host, and
+// respect robots.txt unless ignored.
+func (c *crawler) probe(paramURL string) {
+	site, err := url.Parse(paramURL)
+	if err != nil || site.Host == "" || c.wapp.Fetcher == nil || c.wapp.Config.CacheMode == scraper.CacheReplay {
+		return
+	}
+	byPath := make(map[string][]probedApp)
+	for _, app := range c.wapp.Apps {
+		for i := range app.Probes {
+			p := &app.Probes[i]
+			if strings.HasPrefix(p.Path, "/") {
+				byPath[p.Path] = append(byPath[p.Path], probedApp{app, p})
+			}
+		}
+	}
+	paths := c.probedPaths(byPath)
+	if len(paths) > c.wapp.Config.MaxProbes {
+		log.Printf("%d paths to probe, only the first %d are requested", len(paths), c.wapp.Config.MaxProbes)
+		paths = paths[:c.wapp.Config.MaxProbes]
+	}
+	for _, path := range paths {
+		probeURL := &url.URL{Scheme: site.Scheme, Host: site.Host, Path: path}
+		resource, err := c.fetchSitePath(site, path, maxProbeBytes)
+		if err != nil && c.ctx.Err() != nil {
+			log.Printf("Crawl time budget spent before probing %s", probeURL)
+			return
+		} else if err != nil {
+			log.Debugf("Probe of %s failed : %v", probeURL, err)
+			continue
+		}
+		for _, probed := range byPath[path] {
+			matched := &detected{new(sync.Mutex), make(map[string]*resultApp)}
+			if ok, version, confidence := matchProbe(probed.probe, resource); ok {
+				addApp(probed.app, matched, version, confidence)
+			}
+			mergeEvidence(probed.app, matched, c.detected, "probe "+probeURL.String())
+		}
+	}
+}
+
+// probedPaths returns the paths of byPath, those of detected technologies
+// first
+func (c *crawler) probedPaths(byPath map[string][]probedApp) []string {
+	c.detected.Mu.Lock()
+	defer c.detected.Mu.Unlock()
+	paths := make([]string, 0, len(byPath))
+	confirming := make(map[string]bool)
+	for path, probedApps := range byPath {
+		paths = append(paths, path)
+		for _, probed := range probedApps {
+			if _, ok := c.detected.Apps[probed.app.Name]; ok {
+				confirming[path] = true
+			}
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if confirming[paths[i]] != confirming[paths[j]] {
+			return confirming[paths[i]]
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+// matchProbe tells whether resource is the response expected by p, with the
+// version found by its patterns and the lowest of their confidences. Probes
+// without patterns don't match responses redirected to another path, such
+// as the home page of sites answering 200 to any URL.
+func matchProbe(p *probe, resource *scraper.FetchedResource) (ok bool, version string, confidence int) {
+	status := p.Status
+	if status == 0 {
+		status = 200
+	}
+	if resource.Status != status {
+		return false, "", 0
+	}
+	confidence = p.Confidence
+	if confidence == 0 {
+		confidence = 100
+	}
+	if p.Body == "" && len(p.Headers) == 0 {
+		final, err := url.Parse(resource.URL)
+		if err != nil || strings.TrimSuffix(final.Path, "/") != strings.TrimSuffix(p.Path, "/") {
+			return false, "", 0
+		}
+		return true, "", confidence
+	}
+	match := func(pattrn *pattern, values []string) bool {
+		for _, value := range values {
+			if pattrn.str == "" || (pattrn.regex != nil && pattrn.regex.MatchString(value)) {
+				if found := detectVersion(pattrn, &value); version == "" {
+					version = found
+				}
+				if pattrn.confidence < confidence {
+					confidence = pattrn.confidence
+				}
+				return true
+			}
+		}
+		return false
+	}
+	if p.Body != "" {
+		for _, pattrn := range parsePatterns(p.Body)["main"] {
+			if !match(pattrn, []string{string(resource.Body)}) {
+				return false, "", 0
+			}
+		}
+	}
+	headers := make(map[string]interface{}, len(p.Headers))
+	for name, value := range p.Headers {
+		headers[name] = value
+	}
+	for name, patterns := range parsePatterns(headers) {
+		for _, pattrn := range patterns {
+			if !match(pattrn, resource.Headers.Values(name)) {
+				return false, "", 0
+			}
+		}
+	}
+	return true, version, confidence
+}
+
+// addStarterProbes adds the probes of the embedded starter set to the
+// technologies without probes rules
+func addStarterProbes(apps map[string]*application, starter map[string][]probe) {
+	for name, probes := range starter {
+		if app, ok := apps[name]; ok && len(app.Probes) == 0 {
+			app.Probes = probes
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unstppbl/gowap/pkg/scraper"
+)
+
+func TestMatchProbe(t *testing.T) {
+	resource := &scraper.FetchedResource{
+		URL:     "https://example.com/server-status",
+		Status:  200,
+		Headers: http.Header{"Server": {"Apache/2.4.41 (Ubuntu)"}},
+		Body:    []byte("<h1>Apache Server Status for example.com</h1><dl><dt>Server Version: Apache/2.4.41 (Ubuntu)</dt>"),
+	}
+	probes := []struct {
+		probe      probe
+		ok         bool
+		version    string
+		confidence int
+	}{
+		{probe{Path: "/server-status"}, true, "", 100},
+		{probe{Path: "/server-status", Status: 404}, false, "", 0},
+		{probe{Path: "/server-status", Body: "Server Version: Apache/([\\d.]+)\\;version:\\1"}, true, "2.4.41", 100},
+		{probe{Path: "/server-status", Body: "nginx"}, false, "", 0},
+		{probe{Path: "/server-status", Headers: map[string]string{"server": "Apache\\;confidence:50"}, Confidence: 80}, true, "", 50},
+		{probe{Path: "/server-status", Headers: map[string]string{"X-Powered-By": ""}}, false, "", 0},
+		{probe{Path: "/status"}, false, "", 0},
+	}
+	for _, test := range probes {
+		ok, version, confidence := matchProbe(&test.probe, resource)
+		assert.Equal(t, test.ok, ok, test.probe)
+		assert.Equal(t, test.version, version, test.probe)
+		assert.Equal(t, test.confidence, confidence, test.probe)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	var lock sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+		case "/acme/VERSION":
+			fmt.Fprint(w, "Acme 3.2.1")
+		case "/manager":
+			w.Header().Set("WWW-Authenticate", `Basic realm="Widget Manager"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/old-admin":
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			// Answers 200 to any URL
+			fmt.Fprint(w, `<html><body>Powered by acme</body></html>`)
+		}
+	}))
+	defer ts.Close()
+	technologies := []byte(`{"categories":{"1":{"name":"CMS","priority":1}},"technologies":{
+		"Acme":{"cats":[1],"html":"Powered by acme\\;confidence:50","implies":"Acme Runtime","probes":[{"path":"/acme/VERSION","body":"Acme ([\\d.]+)\\;version:\\1"}]},
+		"Acme Runtime":{"cats":[1]},
+		"Widget":{"cats":[1],"probes":[{"path":"/manager","status":401,"headers":{"WWW-Authenticate":"Widget Manager"}}],"implies":"Widget Server"},
+		"Widget Server":{"cats":[1]},
+		"Soft404":{"cats":[1],"probes":[{"path":"/old-admin"}]},
+		"Private":{"cats":[1],"probes":[{"path":"/private/"}]},
+		"Unprobed":{"cats":[1],"probes":[{"path":"/zzz"}]}}}`)
+
+	config := NewConfig()
+	config.Scraper = "colly"
+	config.ActiveProbing = true
+	config.MaxProbes = 4
+	config.DNSDisabled = true
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	assert.NotEmpty(t, wapp.Apps["WordPress"].Probes, "The starter set should be added to the included technologies")
+	if !assert.NoError(t, parseTechnologiesFile(&technologies, wapp), "Technologies parsing error") {
+		return
+	}
+	res, err := wapp.Analyze(ts.URL)
+	if assert.NoError(t, err, "GoWap Analyze error") {
+		var output output
+		err = json.UnmarshalFromString(res.(string), &output)
+		if assert.NoError(t, err, "Unmarshal error") {
+			found := make(map[string]technology)
+			for _, v := range output.Technologies {
+				found[v.Name] = v
+			}
+			assert.Equal(t, []string{"Acme", "Acme Runtime", "Widget", "Widget Server"}, sortedKeys(found))
+			assert.Equal(t, "3.2.1", found["Acme"].Version)
+			assert.Equal(t, 100, found["Acme"].Confidence, "The probe should confirm the technology")
+			assert.Equal(t, []string{"probe " + ts.URL + "/manager"}, found["Widget"].Evidence)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, requests["/acme/VERSION"], "The paths of detected technologies should be probed first")
+	assert.Equal(t, 0, requests["/private/"], "robots.txt should be respected")
+	assert.Equal(t, 0, requests["/zzz"], "At most MaxProbes paths should be probed")
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces the requests sent to each host with a token bucket
+// (requestsPerSecond, burst) and a minimum delay between two requests,
+// raised to the robots.txt Crawl-delay when the host asks for more
+type hostLimiter struct {
+	mu                sync.Mutex
+	requestsPerSecond float64
+	burst             int
+	minDelay          time.Duration
+	buckets           map[string]*hostBucket
+}
+
+type hostBucket struct {
+	tokens     float64
+	last       time.Time
+	next       time.Time
+	crawlDelay time.Duration
+	crawlKnown bool
+}
+
+func newHostLimiter(requestsPerSecond float64, burst int, minDelay time.Duration) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		requestsPerSecond: requestsPerSecond,
+		burst:             burst,
+		minDelay:          minDelay,
+		buckets:           make(map[string]*hostBucket),
+	}
+}
+
+func (l *hostLimiter) bucket(host string) *hostBucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &hostBucket{tokens: float64(l.burst), last: time.Now()}
+		l.buckets[host] = b
+	}
+	return b
+}
+
+// hasCrawlDelay tells whether the Crawl-delay of host was already set
+func (l *hostLimiter) hasCrawlDelay(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bucket(host).crawlKnown
+}
+
+// setCrawlDelay sets the robots.txt Crawl-delay of host
+func (l *hostLimiter) setCrawlDelay(host string, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(host)
+	b.crawlDelay = delay
+	b.crawlKnown = true
+}
+
+// reserve books the next request slot of host and returns when it starts
+func (l *hostLimiter) reserve(host string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(host)
+	now := time.Now()
+	start := now
+	if b.next.After(start) {
+		start = b.next
+	}
+	if l.requestsPerSecond > 0 {
+		// Tokens refilled until the slot, capped by the burst size
+		tokens := b.tokens
+		if start.After(b.last) {
+			tokens += start.Sub(b.last).Seconds() * l.requestsPerSecond
+		}
+		if tokens > float64(l.burst) {
+			tokens = float64(l.burst)
+		}
+		if tokens < 1 {
+			start = start.Add(time.Duration((1 - tokens) / l.requestsPerSecond * float64(time.Second)))
+			tokens = 1
+		}
+		b.tokens = tokens - 1
+		b.last = start
+	}
+	delay := l.minDelay
+	if b.crawlDelay > delay {
+		delay = b.crawlDelay
+	}
+	b.next = start.Add(delay)
+	return start
+}
+
+// wait blocks until a request to host is allowed or ctx is done
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	start := l.reserve(host)
+	delay := time.Until(start)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
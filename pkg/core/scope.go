@@ -0,0 +1,160 @@
+package core
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/unstppbl/gowap/pkg/publicsuffix"
+	"github.com/unstppbl/gowap/pkg/urlnorm"
+)
+
+// scopeRules are the compiled crawl scope settings of the Config
+type scopeRules struct {
+	include          []*regexp.Regexp
+	exclude          []*regexp.Regexp
+	subdomains       bool
+	schemes          map[string]struct{}
+	maxQueryVariants int
+	excludedExts     map[string]struct{}
+}
+
+// crawlScope decides which links of one Analyze call are crawled
+type crawlScope struct {
+	rules *scopeRules
+	start *url.URL
+	// domain is the registrable domain of the start host, to which
+	// subdomains are compared
+	domain   string
+	variants map[string]map[string]struct{}
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Errorf("Invalid scope pattern %s : %v", pattern, err)
+			return nil, errors.New("InvalidScopePattern")
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+func newScopeRules(config *Config) (rules *scopeRules, err error) {
+	rules = &scopeRules{
+		subdomains:       config.ScopeSubdomains,
+		schemes:          make(map[string]struct{}),
+		maxQueryVariants: config.ScopeMaxQueryVariants,
+		excludedExts:     make(map[string]struct{}),
+	}
+	if rules.include, err = compilePatterns(config.ScopeIncludePatterns); err != nil {
+		return nil, err
+	}
+	if rules.exclude, err = compilePatterns(config.ScopeExcludePatterns); err != nil {
+		return nil, err
+	}
+	for _, scheme := range config.ScopeSchemes {
+		rules.schemes[strings.ToLower(scheme)] = struct{}{}
+	}
+	for _, ext := range config.ScopeExcludedExtensions {
+		rules.excludedExts[strings.ToLower(strings.TrimPrefix(ext, "."))] = struct{}{}
+	}
+	return rules, nil
+}
+
+func newCrawlScope(rules *scopeRules, startURL string) *crawlScope {
+	start, err := url.Parse(startURL)
+	if err != nil {
+		start = &url.URL{}
+	}
+	// Hosts without registrable domain (IPs, localhost) have no subdomains
+	domain, err := publicsuffix.RegistrableDomain(start.Hostname())
+	if err != nil {
+		domain = strings.ToLower(start.Hostname())
+	}
+	return &crawlScope{
+		rules:    rules,
+		start:    start,
+		domain:   domain,
+		variants: make(map[string]map[string]struct{}),
+	}
+}
+
+// inHost tells whether the host of link is the start host, or another host
+// of its registrable domain when subdomains are allowed
+func (s *crawlScope) inHost(link *url.URL) bool {
+	if strings.EqualFold(link.Host, s.start.Host) {
+		return true
+	}
+	if !s.rules.subdomains || s.domain == "" {
+		return false
+	}
+	hostname := strings.ToLower(link.Hostname())
+	return hostname == s.domain || strings.HasSuffix(hostname, "."+s.domain)
+}
+
+// allow returns the normalized URL to crawl for link, without query string
+// unless query variants are allowed. ok is false when link is out of the
+// crawl scope.
+func (s *crawlScope) allow(link string) (crawlURL string, ok bool) {
+	parsed, err := urlnorm.Normalize(nil, link)
+	if err != nil || parsed.Host == "" {
+		return "", false
+	}
+	if _, allowed := s.rules.schemes[strings.ToLower(parsed.Scheme)]; !allowed {
+		return "", false
+	}
+	if !s.inHost(parsed) {
+		return "", false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(parsed.Path), "."))
+	if _, excluded := s.rules.excludedExts[ext]; ext != "" && excluded {
+		return "", false
+	}
+
+	query := parsed.RawQuery
+	parsed.RawQuery = ""
+	pagePath := parsed.String()
+	crawlURL = pagePath
+	if s.rules.maxQueryVariants > 0 && query != "" {
+		crawlURL += "?" + query
+	}
+
+	if len(s.rules.include) > 0 {
+		included := false
+		for _, regex := range s.rules.include {
+			if regex.MatchString(crawlURL) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "", false
+		}
+	}
+	for _, regex := range s.rules.exclude {
+		if regex.MatchString(crawlURL) {
+			return "", false
+		}
+	}
+
+	if s.rules.maxQueryVariants > 0 && query != "" {
+		variants, exists := s.variants[pagePath]
+		if !exists {
+			variants = make(map[string]struct{})
+			s.variants[pagePath] = variants
+		}
+		if _, seen := variants[query]; !seen {
+			if len(variants) >= s.rules.maxQueryVariants {
+				return "", false
+			}
+			variants[query] = struct{}{}
+		}
+	}
+	return crawlURL, true
+}
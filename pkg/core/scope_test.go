@@ -0,0 +1,136 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_crawlScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		startURL string
+		config   func(*Config)
+		links    []string
+		want     []string
+	}{
+		{
+			name:   "default scope",
+			config: func(config *Config) {},
+			links: []string{
+				"https://www.qwerty.com/about/",
+				"https://www.qwerty.com/search?q=1#results",
+				"http://www.qwerty.com/plain",
+				"https://blog.qwerty.com/post",
+				"https://other.com/",
+				"ftp://www.qwerty.com/file",
+				"mailto:me@qwerty.com",
+				"https://www.qwerty.com/brochure.PDF",
+				"https://www.qwerty.com/index.php",
+			},
+			want: []string{
+				"https://www.qwerty.com/about",
+				"https://www.qwerty.com/search",
+				"http://www.qwerty.com/plain",
+				"https://www.qwerty.com/index.php",
+			},
+		},
+		{
+			name: "subdomains and schemes",
+			config: func(config *Config) {
+				config.ScopeSubdomains = true
+				config.ScopeSchemes = []string{"https"}
+			},
+			links: []string{
+				"https://blog.qwerty.com/post",
+				"https://qwerty.com",
+				"http://www.qwerty.com/plain",
+				"https://notqwerty.com/",
+			},
+			want: []string{
+				"https://blog.qwerty.com/post",
+				"https://qwerty.com",
+			},
+		},
+		{
+			name:     "subdomains of the registrable domain",
+			startURL: "https://shop.qwerty.co.uk",
+			config: func(config *Config) {
+				config.ScopeSubdomains = true
+			},
+			links: []string{
+				"https://cdn.qwerty.co.uk/app",
+				"https://qwerty.co.uk/",
+				"https://other.co.uk/",
+			},
+			want: []string{
+				"https://cdn.qwerty.co.uk/app",
+				"https://qwerty.co.uk",
+			},
+		},
+		{
+			name: "include and exclude patterns",
+			config: func(config *Config) {
+				config.ScopeIncludePatterns = []string{`/(docs|blog)/`}
+				config.ScopeExcludePatterns = []string{`(?i)logout`, `/calendar/\d+`}
+			},
+			links: []string{
+				"https://www.qwerty.com/docs/start",
+				"https://www.qwerty.com/blog/Logout",
+				"https://www.qwerty.com/blog/calendar/2021",
+				"https://www.qwerty.com/shop/item",
+			},
+			want: []string{
+				"https://www.qwerty.com/docs/start",
+			},
+		},
+		{
+			name: "query variants",
+			config: func(config *Config) {
+				config.ScopeMaxQueryVariants = 2
+				config.ScopeExcludedExtensions = nil
+			},
+			links: []string{
+				"https://www.qwerty.com/list?page=1",
+				"https://www.qwerty.com/list?page=2",
+				"https://www.qwerty.com/list?page=1",
+				"https://www.qwerty.com/list?page=3",
+				"https://www.qwerty.com/list",
+				"https://www.qwerty.com/photo.jpg",
+			},
+			want: []string{
+				"https://www.qwerty.com/list?page=1",
+				"https://www.qwerty.com/list?page=2",
+				"https://www.qwerty.com/list?page=1",
+				"https://www.qwerty.com/list",
+				"https://www.qwerty.com/photo.jpg",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewConfig()
+			tt.config(config)
+			rules, err := newScopeRules(config)
+			if assert.NoError(t, err) {
+				startURL := tt.startURL
+				if startURL == "" {
+					startURL = "https://www.qwerty.com"
+				}
+				scope := newCrawlScope(rules, startURL)
+				var got []string
+				for _, link := range tt.links {
+					if crawlURL, ok := scope.allow(link); ok {
+						got = append(got, crawlURL)
+					}
+				}
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	config := NewConfig()
+	config.ScopeExcludePatterns = []string{"(unclosed"}
+	_, err := Init(config)
+	assert.Error(t, err, "Invalid scope patterns should fail Init")
+}
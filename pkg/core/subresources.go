@@ -0,0 +1,90 @@
+package core
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/unstppbl/gowap/pkg/publicsuffix"
+	scraper "github.com/unstppbl/gowap/pkg/scraper"
+)
+
+// sameSite tells whether host belongs to the site of pageHost : the same
+// host, or a host of the same registrable domain (shop.example.co.uk and
+// cdn.example.co.uk)
+func sameSite(pageHost, host string) bool {
+	if pageHost == "" {
+		return false
+	}
+	if strings.EqualFold(pageHost, host) {
+		return true
+	}
+	site, err := publicsuffix.RegistrableDomain(pageHost)
+	if err != nil {
+		return false
+	}
+	hostSite, err := publicsuffix.RegistrableDomain(host)
+	return err == nil && hostSite == site
+}
+
+// responseCookies returns the cookies set by the set-cookie headers, by
+// lower case name as looked up by analyzeCookies
+func responseCookies(headers map[string][]string) map[string]string {
+	cookies := make(map[string]string)
+	response := &http.Response{Header: http.Header{"Set-Cookie": headers["set-cookie"]}}
+	for _, cookie := range response.Cookies() {
+		cookies[strings.ToLower(cookie.Name)] = cookie.Value
+	}
+	return cookies
+}
+
+// analyzeSubresources matches the headers and cookies patterns of app
+// against the responses of the subresources from the site of pageURL.
+// The resources which matched are recorded as evidence.
+func analyzeSubresources(app *application, resources []scraper.ScrapedResource, pageURL string, detectedApplications *detected) {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	for _, resource := range resources {
+		if resource.URL == pageURL {
+			continue
+		}
+		u, err := url.Parse(resource.URL)
+		if err != nil || !sameSite(page.Hostname(), u.Hostname()) {
+			continue
+		}
+		if app.Headers != nil && len(resource.Headers) > 0 {
+			matched := &detected{new(sync.Mutex), make(map[string]*resultApp)}
+			analyzeHeaders(app, resource.Headers, matched)
+			mergeEvidence(app, matched, detectedApplications, "headers of "+resource.URL)
+		}
+		if app.Cookies != nil {
+			if cookies := responseCookies(resource.Headers); len(cookies) > 0 {
+				matched := &detected{new(sync.Mutex), make(map[string]*resultApp)}
+				analyzeCookies(app, cookies, matched)
+				mergeEvidence(app, matched, detectedApplications, "cookies of "+resource.URL)
+			}
+		}
+	}
+}
+
+// mergeEvidence adds app to detectedApplications when found in matched,
+// with evidence. Both are done under the same lock, the technology could
+// otherwise be excluded by another page in between.
+func mergeEvidence(app *application, matched *detected, detectedApplications *detected, evidence string) {
+	found, ok := matched.Apps[app.Name]
+	if !ok {
+		return
+	}
+	detectedApplications.Mu.Lock()
+	defer detectedApplications.Mu.Unlock()
+	technology := &addAppLocked(app, detectedApplications, found.technology.Version, found.technology.Confidence).technology
+	for _, known := range technology.Evidence {
+		if known == evidence {
+			return
+		}
+	}
+	technology.Evidence = append(technology.Evidence, evidence)
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unstppbl/gowap/pkg/scraper"
+)
+
+func Test_sameSite(t *testing.T) {
+	assert.True(t, sameSite("www.example.com", "example.com"))
+	assert.True(t, sameSite("www.example.com", "static.example.com"))
+	assert.True(t, sameSite("example.com", "www.example.com"))
+	assert.False(t, sameSite("example.com", "badexample.com"))
+	assert.False(t, sameSite("example.com", "cdn.other.com"))
+	assert.False(t, sameSite("", "example.com"))
+	assert.True(t, sameSite("shop.example.co.uk", "cdn.example.co.uk"), "Hosts of the same registrable domain are the same site")
+	assert.False(t, sameSite("example.co.uk", "other.co.uk"), "Public suffixes are not sites")
+	assert.False(t, sameSite("alice.github.io", "bob.github.io"), "Public suffixes are not sites")
+	assert.True(t, sameSite("127.0.0.1", "127.0.0.1"))
+	assert.False(t, sameSite("127.0.0.1", "127.0.0.2"))
+}
+
+func Test_analyzeSubresources(t *testing.T) {
+	config := NewConfig()
+	config.Scraper = "colly"
+	wapp, err := Init(config)
+	if !assert.NoError(t, err, "GoWap Init error") {
+		return
+	}
+	resources := []scraper.ScrapedResource{
+		{URL: "https://www.example.com/", Headers: map[string][]string{"server": {"nginx/1.0.0"}}},
+		{URL: "https://api.example.com/v1/users", Headers: map[string][]string{
+			"x-powered-by": {"PHP/7.4.3"},
+			"set-cookie":   {"laravel_session=abc; Path=/; HttpOnly", "other=1"},
+		}},
+		{URL: "https://cdn.other.com/app.js", Headers: map[string][]string{"x-powered-by": {"Express"}}},
+	}
+	detectedApp := &detected{Mu: new(sync.Mutex), Apps: make(map[string]*resultApp)}
+	for _, name := range []string{"Nginx", "PHP", "Laravel", "Express"} {
+		analyzeSubresources(wapp.Apps[name], resources, "https://www.example.com/", detectedApp)
+	}
+	assert.NotContains(t, detectedApp.Apps, "Nginx", "The page itself is not a subresource")
+	assert.NotContains(t, detectedApp.Apps, "Express", "Other sites should be ignored")
+	if assert.Contains(t, detectedApp.Apps, "PHP") {
+		assert.Equal(t, "7.4.3", detectedApp.Apps["PHP"].technology.Version)
+		assert.Equal(t, []string{"headers of https://api.example.com/v1/users"}, detectedApp.Apps["PHP"].technology.Evidence)
+	}
+	if assert.Contains(t, detectedApp.Apps, "Laravel") {
+		assert.Equal(t, []string{"cookies of https://api.example.com/v1/users"}, detectedApp.Apps["Laravel"].technology.Evidence)
+	}
+}
+
+func Test_mergeEvidence(t *testing.T) {
+	app := &application{Name: "Acme"}
+	matched := &detected{Mu: new(sync.Mutex), Apps: make(map[string]*resultApp)}
+	addApp(app, matched, "1.0", 100)
+	detectedApp := &detected{Mu: new(sync.Mutex), Apps: make(map[string]*resultApp)}
+
+	// Another page excluding the technology while evidence is merged
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			detectedApp.Mu.Lock()
+			delete(detectedApp.Apps, "Acme")
+			detectedApp.Mu.Unlock()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		mergeEvidence(app, matched, detectedApp, "favicon /favicon.ico")
+	}
+	wg.Wait()
+
+	mergeEvidence(app, matched, detectedApp, "favicon /favicon.ico")
+	mergeEvidence(app, matched, detectedApp, "favicon /favicon.ico")
+	if assert.Contains(t, detectedApp.Apps, "Acme") {
+		assert.Equal(t, "1.0", detectedApp.Apps["Acme"].technology.Version)
+		assert.Equal(t, []string{"favicon /favicon.ico"}, detectedApp.Apps["Acme"].technology.Evidence, "Evidence should be added once")
+	}
+}
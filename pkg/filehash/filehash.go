@@ -0,0 +1,263 @@
+// Package filehash finds the versions of technologies from the hashes of
+// their static files, which are byte-identical in every install of a
+// release (wp-includes/js/..., CKEditor files, ...)
+package filehash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	stdjson "encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/unstppbl/gowap/pkg/vuln"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// ErrInvalidRange is returned for version ranges which are not "1.2.3" or
+// "1.2.0 - 1.2.5"
+var ErrInvalidRange = errors.New("InvalidVersionRange")
+
+// Range is an inclusive range of versions, a single one when From and To
+// are equal. It is written "1.2.0 - 1.2.5", or "1.2.3".
+type Range struct {
+	From string
+	To   string
+}
+
+// ParseRange parses a range written by Range.String
+func ParseRange(s string) (Range, error) {
+	parts := strings.Split(s, " - ")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+		if parts[i] == "" {
+			return Range{}, ErrInvalidRange
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return Range{parts[0], parts[0]}, nil
+	case 2:
+		if vuln.CompareVersions(parts[0], parts[1]) > 0 {
+			return Range{}, ErrInvalidRange
+		}
+		return Range{parts[0], parts[1]}, nil
+	}
+	return Range{}, ErrInvalidRange
+}
+
+func (r Range) String() string {
+	if vuln.CompareVersions(r.From, r.To) == 0 {
+		return r.From
+	}
+	return r.From + " - " + r.To
+}
+
+func (r Range) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Range) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseRange(s)
+	if err == nil {
+		*r = parsed
+	}
+	return err
+}
+
+// Contains tells whether version is in r
+func (r Range) Contains(version string) bool {
+	return vuln.CompareVersions(version, r.From) >= 0 && vuln.CompareVersions(version, r.To) <= 0
+}
+
+// Intersect returns the versions both in a and in b
+func Intersect(a, b []Range) (res []Range) {
+	for _, rangeA := range a {
+		for _, rangeB := range b {
+			from, to := rangeA.From, rangeA.To
+			if vuln.CompareVersions(rangeB.From, from) > 0 {
+				from = rangeB.From
+			}
+			if vuln.CompareVersions(rangeB.To, to) < 0 {
+				to = rangeB.To
+			}
+			if vuln.CompareVersions(from, to) <= 0 {
+				res = append(res, Range{from, to})
+			}
+		}
+	}
+	return res
+}
+
+// Single returns the version of ranges when they hold only one
+func Single(ranges []Range) (string, bool) {
+	if len(ranges) == 0 {
+		return "", false
+	}
+	for _, r := range ranges {
+		if vuln.CompareVersions(r.From, r.To) != 0 || vuln.CompareVersions(r.From, ranges[0].From) != 0 {
+			return "", false
+		}
+	}
+	return ranges[0].From, true
+}
+
+// WithPrefix returns the ranges holding versions starting with the segments
+// of prefix : "3.2" is the prefix of 3.2, 3.2.0 and 3.2.5, but not of 3.20
+func WithPrefix(ranges []Range, prefix string) (res []Range) {
+	segments := strings.Split(prefix, ".")
+	last, err := strconv.ParseUint(segments[len(segments)-1], 10, 64)
+	// The versions with the prefix are before the next value of its last segment
+	segments[len(segments)-1] = strconv.FormatUint(last+1, 10)
+	next := strings.Join(segments, ".")
+	for _, r := range ranges {
+		if err != nil {
+			// Other segments have no next value, the prefix is then the version
+			if r.Contains(prefix) {
+				res = append(res, r)
+			}
+		} else if vuln.CompareVersions(r.To, prefix) >= 0 && vuln.CompareVersions(r.From, next) < 0 && !hasPrefix(r.From, next) {
+			// The pre-releases of next sort before it
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+func hasPrefix(version string, prefix string) bool {
+	return version == prefix || strings.HasPrefix(version, prefix+".") || strings.HasPrefix(version, prefix+"-")
+}
+
+// CommonPrefix returns the leading segments shared by the bounds of ranges,
+// "3.2" for 3.2.0 - 3.2.5
+func CommonPrefix(ranges []Range) string {
+	var common []string
+	for i, r := range ranges {
+		for j, bound := range []string{r.From, r.To} {
+			segments := strings.Split(bound, ".")
+			if i == 0 && j == 0 {
+				common = segments
+				continue
+			}
+			n := 0
+			for n < len(common) && n < len(segments) && common[n] == segments[n] {
+				n++
+			}
+			common = common[:n]
+		}
+	}
+	return strings.Join(common, ".")
+}
+
+// File is a static file of a technology, at Path from the root of the
+// sites, with the versions shipping each of its SHA-256 hashes
+type File struct {
+	Path   string             `json:"path"`
+	Hashes map[string][]Range `json:"hashes"`
+}
+
+// Versions returns the versions shipping the file with this hash, none when
+// it is unknown
+func (f *File) Versions(hash string) []Range {
+	return f.Hashes[strings.ToLower(hash)]
+}
+
+// Database holds the hashed files of the technologies, by name, listed
+// from the most to the least telling
+type Database struct {
+	Technologies map[string][]*File `json:"technologies"`
+}
+
+// NewDatabase returns an empty database
+func NewDatabase() *Database {
+	return &Database{Technologies: make(map[string][]*File)}
+}
+
+// Load reads a database written by Write
+func Load(path string) (*Database, error) {
+	log.Infof("Loading file hashes database %s", path)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db := NewDatabase()
+	if err := json.Unmarshal(content, db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Write stores the database as indented JSON
+func (db *Database) Write(path string) error {
+	content, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	// jsoniter doesn't indent the output of the Range marshaler
+	var indented bytes.Buffer
+	if err := stdjson.Indent(&indented, content, "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, indented.Bytes(), 0644)
+}
+
+// Files returns the hashed files of technology
+func (db *Database) Files(technology string) []*File {
+	return db.Technologies[technology]
+}
+
+// Hash returns the hex SHA-256 hash of content
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Add records that version of technology ships the file at path with this
+// hash
+func (db *Database) Add(technology string, path string, hash string, version string) {
+	var file *File
+	for _, known := range db.Technologies[technology] {
+		if known.Path == path {
+			file = known
+		}
+	}
+	if file == nil {
+		file = &File{Path: path, Hashes: make(map[string][]Range)}
+		db.Technologies[technology] = append(db.Technologies[technology], file)
+	}
+	hash = strings.ToLower(hash)
+	for _, r := range file.Hashes[hash] {
+		if r.Contains(version) {
+			return
+		}
+	}
+	file.Hashes[hash] = append(file.Hashes[hash], Range{version, version})
+	sort.Slice(file.Hashes[hash], func(i, j int) bool {
+		return vuln.CompareVersions(file.Hashes[hash][i].From, file.Hashes[hash][j].From) < 0
+	})
+}
+
+// AddRelease hashes the files at paths of a release of technology unpacked
+// in dir, such as /wp-includes/js/wp-embed.min.js in wordpress-5.8/
+func (db *Database) AddRelease(technology string, version string, dir string, paths []string) error {
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			return err
+		}
+		db.Add(technology, path, Hash(content), version)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package filehash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	ranges := map[string]Range{
+		"5.8":           {"5.8", "5.8"},
+		" 5.8 - 5.8.2 ": {"5.8", "5.8.2"},
+		"4.0.0-rc1 - 4": {"4.0.0-rc1", "4"},
+	}
+	for s, expected := range ranges {
+		r, err := ParseRange(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, r, s)
+		}
+	}
+	for _, s := range []string{"", "5.8 - ", "5.9 - 5.8", "1 - 2 - 3"} {
+		_, err := ParseRange(s)
+		assert.Equal(t, ErrInvalidRange, err, s)
+	}
+	assert.Equal(t, "5.8 - 5.8.2", Range{"5.8", "5.8.2"}.String())
+	assert.Equal(t, "5.8", Range{"5.8", "5.8.0"}.String())
+}
+
+func TestIntersect(t *testing.T) {
+	a := []Range{{"2.0", "2.3"}, {"3.0", "3.0"}}
+	assert.Equal(t, []Range{{"2.1", "2.3"}}, Intersect(a, []Range{{"2.1", "2.4"}}))
+	assert.Equal(t, []Range{{"2.3", "2.3"}, {"3.0", "3.0"}}, Intersect(a, []Range{{"2.3", "3.1"}}))
+	assert.Empty(t, Intersect(a, []Range{{"2.4", "2.9"}}))
+
+	version, ok := Single([]Range{{"2.3", "2.3"}, {"2.3.0", "2.3"}})
+	assert.True(t, ok)
+	assert.Equal(t, "2.3", version)
+	_, ok = Single([]Range{{"2.3", "2.3"}, {"3.0", "3.0"}})
+	assert.False(t, ok)
+	_, ok = Single(nil)
+	assert.False(t, ok)
+}
+
+func TestWithPrefix(t *testing.T) {
+	ranges := []Range{{"2.9", "3.0.2"}, {"3.2.0", "3.2.5"}, {"3.20", "3.20"}, {"4.0-beta", "4.0-beta"}}
+	assert.Equal(t, ranges[:3], WithPrefix(ranges, "3"))
+	assert.Equal(t, []Range{{"3.2.0", "3.2.5"}}, WithPrefix(ranges, "3.2"))
+	assert.Equal(t, []Range{{"3.2.0", "3.2.5"}}, WithPrefix(ranges, "3.2.5"))
+	assert.Equal(t, []Range{{"4.0-beta", "4.0-beta"}}, WithPrefix(ranges, "4.0-beta"))
+	assert.Empty(t, WithPrefix(ranges, "1"))
+
+	assert.Equal(t, "3.2", CommonPrefix([]Range{{"3.2.0", "3.2.5"}, {"3.2.7", "3.2.7"}}))
+	assert.Equal(t, "3", CommonPrefix([]Range{{"3.0.1", "3.2.5"}}))
+	assert.Equal(t, "", CommonPrefix([]Range{{"2.9", "3.0.2"}}))
+}
+
+func TestDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filehash")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for version, content := range map[string]string{"1.0": "v1", "1.1": "v1", "2.0": "v2"} {
+		release := filepath.Join(dir, version, "static")
+		if assert.NoError(t, os.MkdirAll(release, 0755)) {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(release, "app.js"), []byte(content), 0644))
+		}
+	}
+
+	db := NewDatabase()
+	for _, version := range []string{"2.0", "1.1", "1.0"} {
+		assert.NoError(t, db.AddRelease("Acme", version, filepath.Join(dir, version), []string{"/static/app.js"}))
+	}
+	assert.Error(t, db.AddRelease("Acme", "3.0", filepath.Join(dir, "3.0"), []string{"/static/app.js"}))
+	db.Add("Acme", "/static/app.js", Hash([]byte("v1")), "1.0")
+
+	path := filepath.Join(dir, "hashes.json")
+	if !assert.NoError(t, db.Write(path)) {
+		return
+	}
+	loaded, err := Load(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	files := loaded.Files("Acme")
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "/static/app.js", files[0].Path)
+		assert.Equal(t, []Range{{"1.0", "1.0"}, {"1.1", "1.1"}}, files[0].Versions(Hash([]byte("v1"))))
+		assert.Equal(t, []Range{{"2.0", "2.0"}}, files[0].Versions(Hash([]byte("v2"))))
+		assert.Empty(t, files[0].Versions(Hash([]byte("custom"))))
+	}
+	assert.Empty(t, loaded.Files("Other"))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"technologies":{"Acme":[{"path":"/a.js","hashes":{"00":["2.0 - 1.0"]}}]}}`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err, "Invalid ranges should be rejected")
+}
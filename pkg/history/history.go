@@ -0,0 +1,206 @@
+package history
+
+import (
+	"bufio"
+	"errors"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Technology is a detected technology as recorded in the history
+type Technology struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Scan is the result of one analysis of a site
+type Scan struct {
+	Site         string       `json:"site"`
+	Time         time.Time    `json:"time"`
+	Technologies []Technology `json:"technologies"`
+}
+
+// VersionChange is a technology whose version differs between two scans
+type VersionChange struct {
+	Name        string `json:"name"`
+	FromVersion string `json:"from"`
+	ToVersion   string `json:"to"`
+}
+
+// Diff lists the changes between two scans of a site
+type Diff struct {
+	Site    string          `json:"site"`
+	From    *time.Time      `json:"from,omitempty"`
+	To      time.Time       `json:"to"`
+	Added   []Technology    `json:"added,omitempty"`
+	Removed []Technology    `json:"removed,omitempty"`
+	Changed []VersionChange `json:"changed,omitempty"`
+}
+
+// Store is an append-only scan history kept in a single JSON lines file
+type Store struct {
+	mu    sync.RWMutex
+	file  *os.File
+	scans map[string][]*Scan
+}
+
+// Open loads the history file at path, creating it when missing
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{file: file, scans: make(map[string][]*Scan)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		scan := &Scan{}
+		if err := json.Unmarshal(scanner.Bytes(), scan); err != nil {
+			// A truncated last line (crash while writing) should not lose the whole history
+			log.Warningf("Skipping corrupted history record at %s:%d : %v", path, line, err)
+			continue
+		}
+		store.scans[scan.Site] = append(store.scans[scan.Site], scan)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Terminate a truncated last line so the next record starts on its own line
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := file.Write([]byte{'\n'}); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+	for _, scans := range store.scans {
+		sort.SliceStable(scans, func(i, j int) bool { return scans[i].Time.Before(scans[j].Time) })
+	}
+	return store, nil
+}
+
+// Close closes the underlying file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Record appends a scan of site to the history
+func (s *Store) Record(site string, at time.Time, technologies []Technology) (*Scan, error) {
+	scan := &Scan{Site: SiteKey(site), Time: at.UTC(), Technologies: append([]Technology{}, technologies...)}
+	sort.Slice(scan.Technologies, func(i, j int) bool { return scan.Technologies[i].Name < scan.Technologies[j].Name })
+	line, err := json.Marshal(scan)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	if err = s.file.Sync(); err != nil {
+		return nil, err
+	}
+	s.scans[scan.Site] = append(s.scans[scan.Site], scan)
+	return scan, nil
+}
+
+// Scans returns the recorded scans of site, oldest first
+func (s *Store) Scans(site string) []Scan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []Scan
+	for _, scan := range s.scans[SiteKey(site)] {
+		res = append(res, *scan)
+	}
+	return res
+}
+
+// Sites returns the sites having at least one recorded scan
+func (s *Store) Sites() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []string
+	for site := range s.scans {
+		res = append(res, site)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Diff compares the last scan of site with the previous one. When the site
+// was scanned only once, every technology is reported as added.
+func (s *Store) Diff(site string) (*Diff, error) {
+	scans := s.Scans(site)
+	switch len(scans) {
+	case 0:
+		return nil, errors.New("NoScanFound")
+	case 1:
+		return Compare(nil, &scans[0]), nil
+	}
+	return Compare(&scans[len(scans)-2], &scans[len(scans)-1]), nil
+}
+
+// Compare returns the changes from the previous scan to the current one,
+// previous may be nil
+func Compare(previous *Scan, current *Scan) *Diff {
+	diff := &Diff{Site: current.Site, To: current.Time}
+	before := make(map[string]Technology)
+	if previous != nil {
+		from := previous.Time
+		diff.From = &from
+		for _, tech := range previous.Technologies {
+			before[tech.Name] = tech
+		}
+	}
+	after := make(map[string]Technology)
+	for _, tech := range current.Technologies {
+		after[tech.Name] = tech
+		old, ok := before[tech.Name]
+		if !ok {
+			diff.Added = append(diff.Added, tech)
+		} else if old.Version != tech.Version {
+			diff.Changed = append(diff.Changed, VersionChange{tech.Name, old.Version, tech.Version})
+		}
+	}
+	if previous != nil {
+		for _, tech := range previous.Technologies {
+			if _, ok := after[tech.Name]; !ok {
+				diff.Removed = append(diff.Removed, tech)
+			}
+		}
+	}
+	return diff
+}
+
+// SiteKey normalizes a site URL so that rescans of the same site share
+// their history (scheme and host are lowercased, trailing slashes removed)
+func SiteKey(site string) string {
+	site = strings.TrimSpace(site)
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	u, err := url.Parse(site)
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(site, "/")
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.TrimRight(u.EscapedPath(), "/")
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-history")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	store, err := Open(path)
+	if !assert.NoError(t, err, "History should be created") {
+		return
+	}
+	_, err = store.Diff("https://example.com")
+	assert.Error(t, err, "Diff without scan should throw an error")
+
+	week1 := time.Date(2021, 9, 6, 10, 0, 0, 0, time.UTC)
+	_, err = store.Record("https://Example.com/", week1, []Technology{{"jQuery", "3.4.1"}, {"PHP", ""}, {"Nginx", "1.18"}})
+	assert.NoError(t, err, "Record error")
+	_, err = store.Record("https://other.com", week1, []Technology{{"React", ""}})
+	assert.NoError(t, err, "Record error")
+
+	diff, err := store.Diff("https://example.com")
+	if assert.NoError(t, err, "Diff error") {
+		assert.Nil(t, diff.From, "First scan has no previous scan")
+		assert.Len(t, diff.Added, 3, "Every technology of the first scan is added")
+	}
+
+	_, err = store.Record("https://example.com", week1.Add(7*24*time.Hour), []Technology{{"jQuery", "3.6.0"}, {"Nginx", "1.18"}, {"WordPress", "5.8"}})
+	assert.NoError(t, err, "Record error")
+	assert.NoError(t, store.Close(), "Close error")
+
+	// Reopening should load the previous records
+	store, err = Open(path)
+	if !assert.NoError(t, err, "History should reopen") {
+		return
+	}
+	defer store.Close()
+	assert.Equal(t, []string{"https://example.com", "https://other.com"}, store.Sites())
+	assert.Len(t, store.Scans("example.com"), 2, "Site key should be normalized")
+
+	diff, err = store.Diff("https://example.com/")
+	if assert.NoError(t, err, "Diff error") {
+		assert.Equal(t, week1, *diff.From)
+		assert.Equal(t, []Technology{{"WordPress", "5.8"}}, diff.Added)
+		assert.Equal(t, []Technology{{"PHP", ""}}, diff.Removed)
+		assert.Equal(t, []VersionChange{{"jQuery", "3.4.1", "3.6.0"}}, diff.Changed)
+	}
+}
+
+func TestCorruptedHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-history")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+	err = ioutil.WriteFile(path, []byte(`{"site":"https://example.com","time":"2021-09-06T10:00:00Z","technologies":[{"name":"PHP"}]}
+{"site":"https://example.com","time":"2021-09-13T10:0`), 0644)
+	assert.NoError(t, err, "Fixture write error")
+
+	store, err := Open(path)
+	if assert.NoError(t, err, "Truncated record should be skipped") {
+		assert.Len(t, store.Scans("https://example.com"), 1)
+		_, err = store.Record("https://example.com", time.Now(), []Technology{{"PHP", "8.0"}})
+		assert.NoError(t, err, "Record error")
+		store.Close()
+	}
+	store, err = Open(path)
+	if assert.NoError(t, err, "History should reopen") {
+		defer store.Close()
+		assert.Len(t, store.Scans("https://example.com"), 2, "Record after a truncated line should be kept")
+	}
+
+	_, err = Open(filepath.Join(dir, "does", "not", "exist"))
+	assert.Error(t, err, "Bad path should throw an error")
+}
+
+func TestSiteKey(t *testing.T) {
+	assert.Equal(t, "https://example.com", SiteKey("HTTPS://EXAMPLE.com/"))
+	assert.Equal(t, "https://example.com", SiteKey("example.com"))
+	assert.Equal(t, "http://example.com:8080/blog", SiteKey("http://example.com:8080/blog/"))
+}
@@ -0,0 +1,56 @@
+// Package publicsuffix finds the public suffix (co.uk, github.io, ...) and
+// the registrable domain of host names, with the rules of the Public Suffix
+// List (https://publicsuffix.org/) of golang.org/x/net/publicsuffix
+package publicsuffix
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/unstppbl/gowap/pkg/urlnorm"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ErrNoRegistrableDomain is returned for IP addresses, public suffixes and
+// empty hosts
+var ErrNoRegistrableDomain = errors.New("NoRegistrableDomain")
+
+// normalize lower cases host, converts it to ASCII and removes its port and
+// trailing dot
+func normalize(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return "", ErrNoRegistrableDomain
+	}
+	return urlnorm.ToASCII(host)
+}
+
+// PublicSuffix returns the public suffix of host, such as co.uk for
+// www.example.co.uk, in ASCII
+func PublicSuffix(host string) (string, error) {
+	host, err := normalize(host)
+	if err != nil {
+		return "", err
+	}
+	suffix, _ := publicsuffix.PublicSuffix(host)
+	return suffix, nil
+}
+
+// RegistrableDomain returns the public suffix of host and one more label,
+// such as example.co.uk for www.example.co.uk, in ASCII. Public suffixes
+// themselves have no registrable domain.
+func RegistrableDomain(host string) (string, error) {
+	host, err := normalize(host)
+	if err != nil {
+		return "", err
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", ErrNoRegistrableDomain
+	}
+	return domain, nil
+}
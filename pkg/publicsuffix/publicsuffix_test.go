@@ -0,0 +1,50 @@
+package publicsuffix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	domains := map[string]string{
+		"example.com":             "example.com",
+		"www.example.com":         "example.com",
+		"WWW.Example.COM.":        "example.com",
+		"example.com:8080":        "example.com",
+		"a.b.example.co.uk":       "example.co.uk",
+		"user.github.io":          "user.github.io",
+		"www.city.kawasaki.jp":    "city.kawasaki.jp",
+		"a.b.c.kawasaki.jp":       "b.c.kawasaki.jp",
+		"www.ck":                  "www.ck",
+		"shop.example.unknowntld": "example.unknowntld",
+		"例え.テスト":                  "xn--r8jz45g.xn--zckzah",
+		"www.食狮.公司.cn":            "xn--85x722f.xn--55qx5d.cn",
+	}
+	for host, domain := range domains {
+		registrable, err := RegistrableDomain(host)
+		if assert.NoError(t, err, host) {
+			assert.Equal(t, domain, registrable, host)
+		}
+	}
+	for _, host := range []string{"", "localhost", "com", "co.uk", "github.io", "c.kawasaki.jp", "127.0.0.1", "[::1]:443"} {
+		_, err := RegistrableDomain(host)
+		assert.Equal(t, ErrNoRegistrableDomain, err, host)
+	}
+}
+
+func TestPublicSuffix(t *testing.T) {
+	suffixes := map[string]string{
+		"www.example.co.uk": "co.uk",
+		"example.com":       "com",
+		"user.github.io":    "github.io",
+		"localhost":         "localhost",
+		"a.b.c.kawasaki.jp": "c.kawasaki.jp",
+	}
+	for host, suffix := range suffixes {
+		publicSuffix, err := PublicSuffix(host)
+		if assert.NoError(t, err, host) {
+			assert.Equal(t, suffix, publicSuffix, host)
+		}
+	}
+}
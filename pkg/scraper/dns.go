@@ -0,0 +1,182 @@
+package scraper
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/unstppbl/gowap/pkg/publicsuffix"
+)
+
+// maxCNAMEs is the max length of the followed CNAME chains
+const maxCNAMEs = 8
+
+// verificationKey is the key of the domain verification TXT records, such
+// as google-site-verification=... or MS=ms12345
+var verificationKey = regexp.MustCompile(`(?i)^([a-z0-9._-]*verif[a-z0-9._-]*|ms)$`)
+
+// scrapeDNS returns the DNS records used by the dns rules, by type :
+//   - NS, MX and TXT of the registrable domain of the page (example.co.uk
+//     for www.example.co.uk)
+//   - CNAME chain, A, AAAA, CAA and SOA of the host of the page
+//   - SPF includes, DMARC tags and domain verification keys parsed from
+//     the TXT records
+func scrapeDNS(resolver Resolver, paramURL string) map[string][]string {
+	scrapedDNS := make(map[string][]string)
+	u, err := url.Parse(paramURL)
+	if err != nil {
+		return scrapedDNS
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" || net.ParseIP(host) != nil {
+		return scrapedDNS
+	}
+	domain, err := publicsuffix.RegistrableDomain(host)
+	if err != nil {
+		// Single label hosts of intranets
+		domain = host
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	lookup := func(recordType string, f func() []string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if values := f(); len(values) > 0 {
+				lock.Lock()
+				scrapedDNS[recordType] = append(scrapedDNS[recordType], values...)
+				lock.Unlock()
+			}
+		}()
+	}
+	records := func(name, recordType string) func() []string {
+		return func() []string {
+			return lookupRecords(resolver, name, recordType)
+		}
+	}
+
+	lookup("NS", records(domain, "NS"))
+	lookup("MX", records(domain, "MX"))
+	lookup("TXT", records(domain, "TXT"))
+	lookup("DMARC", func() []string {
+		return parseDMARC(lookupRecords(resolver, "_dmarc."+domain, "TXT"))
+	})
+	lookup("CNAME", func() []string {
+		return cnameChain(resolver, host)
+	})
+	lookup("A", records(host, "A"))
+	lookup("AAAA", records(host, "AAAA"))
+	lookup("CAA", func() []string {
+		return lookupCAA(resolver, host, domain)
+	})
+	lookup("SOA", records(host, "SOA"))
+	wg.Wait()
+
+	scrapedDNS["SPF"] = parseSPF(scrapedDNS["TXT"])
+	scrapedDNS["VERIFICATION"] = parseVerifications(scrapedDNS["TXT"])
+	for recordType, values := range scrapedDNS {
+		if len(values) == 0 {
+			delete(scrapedDNS, recordType)
+		}
+	}
+	return scrapedDNS
+}
+
+// lookupRecords returns the records of name, logging failed lookups
+func lookupRecords(resolver Resolver, name string, recordType string) []string {
+	values, err := resolver.Lookup(name, recordType)
+	if err != nil {
+		log.Debugf("DNS lookup of %s %s failed : %v", recordType, name, err)
+	}
+	return values
+}
+
+// cnameChain follows the CNAME records from host
+func cnameChain(resolver Resolver, host string) (chain []string) {
+	name := host
+	for len(chain) < maxCNAMEs {
+		values := lookupRecords(resolver, name, "CNAME")
+		if len(values) == 0 {
+			break
+		}
+		name = strings.ToLower(values[0])
+		chain = append(chain, name)
+	}
+	return chain
+}
+
+// lookupCAA returns the CAA records applying to host : its own, otherwise
+// those of its closest parent, up to the registrable domain
+func lookupCAA(resolver Resolver, host, domain string) []string {
+	for name := host; ; {
+		if values := lookupRecords(resolver, name, "CAA"); len(values) > 0 || name == domain {
+			return values
+		}
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return nil
+		}
+		name = name[i+1:]
+	}
+}
+
+// parseSPF returns the domains of the SPF records : those of the include:
+// mechanisms, whatever their qualifier, and of the redirect= modifier
+func parseSPF(txtSlice []string) (domains []string) {
+	for _, txt := range txtSlice {
+		fields := strings.Fields(txt)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "v=spf1") {
+			continue
+		}
+		for _, term := range fields[1:] {
+			term = strings.ToLower(term)
+			if strings.HasPrefix(term, "redirect=") {
+				domains = append(domains, strings.TrimPrefix(term, "redirect="))
+				continue
+			}
+			// Mechanisms have an optional qualifier, + by default
+			if strings.IndexByte("+-~?", term[0]) >= 0 {
+				term = term[1:]
+			}
+			if strings.HasPrefix(term, "include:") {
+				domains = append(domains, strings.TrimPrefix(term, "include:"))
+			}
+		}
+	}
+	return domains
+}
+
+// parseDMARC returns the tags of the DMARC records, such as p=reject or
+// rua=mailto:reports@example.com
+func parseDMARC(txtSlice []string) (tags []string) {
+	for _, txt := range txtSlice {
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(txt)), "v=dmarc1") {
+			continue
+		}
+		for _, tag := range strings.Split(txt, ";") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// parseVerifications returns the lower case keys of the domain verification
+// TXT records, without their tokens
+func parseVerifications(txtSlice []string) (keys []string) {
+	for _, txt := range txtSlice {
+		i := strings.IndexAny(txt, "=:")
+		if i <= 0 {
+			continue
+		}
+		if key := strings.TrimSpace(txt[:i]); verificationKey.MatchString(key) {
+			keys = append(keys, strings.ToLower(key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,221 @@
+package scraper
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// The net package has no lookup of CAA and SOA records, nor of a single
+// CNAME of a chain, they are queried with the minimal DNS client below when
+// a DNS server is configured
+
+// DNS record types
+const (
+	dnsTypeCNAME = 5
+	dnsTypeSOA   = 6
+	dnsTypeCAA   = 257
+	dnsClassIN   = 1
+)
+
+var (
+	errDNSMalformed = errors.New("MalformedDNSMessage")
+	errDNSName      = errors.New("InvalidDNSName")
+)
+
+type dnsRecord struct {
+	Name string
+	Type uint16
+	Data string
+}
+
+// queryDNS asks server for the records of type qtype of name. The records
+// of the authority section are returned too, SOA records are found there
+// when name is not the apex of its zone. Unknown names have no records.
+func queryDNS(server string, timeout time.Duration, name string, qtype uint16) ([]dnsRecord, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+	query, err := buildDNSQuery(id, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	response, err := exchangeDNS("udp", server, timeout, query)
+	if err != nil {
+		return nil, err
+	}
+	records, truncated, err := parseDNSResponse(response, id)
+	if err == nil && truncated {
+		if response, err = exchangeDNS("tcp", server, timeout, query); err == nil {
+			records, _, err = parseDNSResponse(response, id)
+		}
+	}
+	return records, err
+}
+
+// exchangeDNS sends query to server and returns its response. Over TCP,
+// messages are prefixed by their length.
+func exchangeDNS(network, server string, timeout time.Duration, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if network == "udp" {
+		if _, err = conn.Write(query); err != nil {
+			return nil, err
+		}
+		response := make([]byte, 4096)
+		n, err := conn.Read(response)
+		return response[:n], err
+	}
+
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(query)))
+	if _, err = conn.Write(append(length[:], query...)); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	_, err = io.ReadFull(conn, response)
+	return response, err
+}
+
+// buildDNSQuery returns a recursive query of the records of name
+func buildDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, errDNSName
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0, byte(qtype>>8), byte(qtype), 0, dnsClassIN), nil
+}
+
+// parseDNSResponse returns the CNAME, SOA and CAA records of the answer and
+// authority sections of msg
+func parseDNSResponse(msg []byte, id uint16) (records []dnsRecord, truncated bool, err error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+		return nil, false, errDNSMalformed
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	truncated = flags&0x0200 != 0
+	switch rcode := flags & 0x000F; rcode {
+	case 0:
+	case 3:
+		// NXDOMAIN
+		return nil, truncated, nil
+	default:
+		return nil, truncated, fmt.Errorf("DNSError%d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	count := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		if _, offset, err = readDNSName(msg, offset); err != nil {
+			return nil, truncated, err
+		}
+		offset += 4
+	}
+	for i := 0; i < count; i++ {
+		var name string
+		if name, offset, err = readDNSName(msg, offset); err != nil {
+			return nil, truncated, err
+		}
+		if offset+10 > len(msg) {
+			return nil, truncated, errDNSMalformed
+		}
+		rtype := binary.BigEndian.Uint16(msg[offset:])
+		rdLength := int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+rdLength > len(msg) {
+			return nil, truncated, errDNSMalformed
+		}
+		if data, ok := parseRData(msg, offset, rdLength, rtype); ok {
+			records = append(records, dnsRecord{Name: name, Type: rtype, Data: data})
+		}
+		offset += rdLength
+	}
+	return records, truncated, nil
+}
+
+// parseRData formats the data of CNAME, SOA and CAA records as dig does
+func parseRData(msg []byte, offset int, length int, rtype uint16) (string, bool) {
+	switch rtype {
+	case dnsTypeCNAME:
+		name, _, err := readDNSName(msg, offset)
+		return name, err == nil
+	case dnsTypeSOA:
+		mname, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return "", false
+		}
+		rname, next, err := readDNSName(msg, next)
+		if err != nil || next+20 > offset+length {
+			return "", false
+		}
+		values := make([]string, 5)
+		for i := range values {
+			values[i] = fmt.Sprint(binary.BigEndian.Uint32(msg[next+4*i:]))
+		}
+		return mname + " " + rname + " " + strings.Join(values, " "), true
+	case dnsTypeCAA:
+		rdata := msg[offset : offset+length]
+		if len(rdata) < 2 || 2+int(rdata[1]) > len(rdata) {
+			return "", false
+		}
+		tag := string(rdata[2 : 2+rdata[1]])
+		return fmt.Sprintf("%d %s %q", rdata[0], tag, rdata[2+rdata[1]:]), true
+	}
+	return "", false
+}
+
+// readDNSName reads the name at offset, following compression pointers, and
+// returns the offset after it
+func readDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errDNSMalformed
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(msg) || jumps > 16 {
+				return "", 0, errDNSMalformed
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3FFF)
+			jumps++
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errDNSMalformed
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package scraper
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// The extraction below is shared by the scrapers, so that a page gives the
+// same ScrapedData whatever the scraper
+
+// extractResponse fills the URL, status, headers and cookies of scraped
+// from the response to the page. Header names are lower cased, values
+// received several times and joined by new lines are split.
+func extractResponse(scraped *ScrapedData, pageURL string, status int, headers map[string][]string) {
+	scraped.URLs = ScrapedURL{URL: pageURL, Status: status}
+	scraped.Headers = make(map[string][]string)
+	for header, values := range headers {
+		lowerCaseKey := strings.ToLower(header)
+		for _, value := range values {
+			scraped.Headers[lowerCaseKey] = append(scraped.Headers[lowerCaseKey], strings.Split(value, "\n")...)
+		}
+	}
+	scraped.Cookies = make(map[string]string)
+	response := &http.Response{Header: http.Header{"Set-Cookie": scraped.Headers["set-cookie"]}}
+	for _, cookie := range response.Cookies() {
+		scraped.Cookies[cookie.Name] = cookie.Value
+	}
+}
+
+// extractHTML fills the HTML, the meta (by name, property or http-equiv)
+// and the script URLs of scraped from the HTML of the page, and returns the
+// inline scripts
+func extractHTML(scraped *ScrapedData, html string) (inline []string) {
+	scraped.HTML = html
+	scraped.Meta = make(map[string][]string)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil
+	}
+
+	base, _ := url.Parse(scraped.URLs.URL)
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok && base != nil {
+		if baseHref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(baseHref)
+		}
+	}
+
+	doc.Find("script").Each(func(i int, script *goquery.Selection) {
+		src, ok := script.Attr("src")
+		if !ok || strings.TrimSpace(src) == "" {
+			inline = append(inline, script.Text())
+			return
+		}
+		if u, err := url.Parse(strings.TrimSpace(src)); err == nil && base != nil {
+			src = base.ResolveReference(u).String()
+		}
+		scraped.Scripts = append(scraped.Scripts, src)
+	})
+
+	doc.Find("meta").Each(func(i int, meta *goquery.Selection) {
+		content, ok := meta.Attr("content")
+		if !ok {
+			return
+		}
+		for _, attribute := range []string{"name", "property", "http-equiv"} {
+			if name, ok := meta.Attr(attribute); ok && name != "" {
+				nameLower := strings.ToLower(name)
+				scraped.Meta[nameLower] = append(scraped.Meta[nameLower], content)
+				return
+			}
+		}
+	})
+	return inline
+}
+
+// appendCertIssuer adds the names of the certificate issuer to scraped
+func appendCertIssuer(scraped *ScrapedData, names ...string) {
+	for _, name := range names {
+		if name != "" {
+			scraped.CertIssuer = append(scraped.CertIssuer, name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Fetcher downloads the resources needed besides the scraped pages
+// (robots.txt, sitemaps, ...) with a shared connection pool
+type Fetcher struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+// FetchedResource is the response to a Fetcher request
+type FetchedResource struct {
+	URL     string
+	Status  int
+	Headers http.Header
+	Body    []byte
+}
+
+// errHTTPStatus is returned for unexpected response status codes
+func errHTTPStatus(status int) error {
+	return fmt.Errorf("HTTPStatus%d", status)
+}
+
+// NewFetcher returns a Fetcher whose requests time out after timeoutSeconds.
+// The certificates of the servers are verified unless insecureSkipVerify.
+func NewFetcher(timeoutSeconds int, userAgent string, insecureSkipVerify bool) *Fetcher {
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	return &Fetcher{
+		Client: &http.Client{
+			Timeout: 2 * timeout,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout: timeout,
+				}).DialContext,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: timeout,
+				TLSClientConfig:     &tls.Config{InsecureSkipVerify: insecureSkipVerify},
+			},
+		},
+		UserAgent: userAgent,
+	}
+}
+
+// Fetch GETs rawURL, reading at most maxBytes of the body
+func (f *Fetcher) Fetch(rawURL string, maxBytes int64) (*FetchedResource, error) {
+	return f.fetch(rawURL, maxBytes, false)
+}
+
+// FetchPrefix GETs rawURL as Fetch does, but returns the first maxBytes of
+// a larger body instead of an error
+func (f *Fetcher) FetchPrefix(rawURL string, maxBytes int64) (*FetchedResource, error) {
+	return f.fetch(rawURL, maxBytes, true)
+}
+
+func (f *Fetcher) fetch(rawURL string, maxBytes int64, truncate bool) (*FetchedResource, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		if !truncate {
+			return nil, errors.New("ResourceTooLarge")
+		}
+		body = body[:maxBytes]
+	}
+	return &FetchedResource{
+		URL:     resp.Request.URL.String(),
+		Status:  resp.StatusCode,
+		Headers: resp.Header,
+		Body:    body,
+	}, nil
+}
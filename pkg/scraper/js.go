@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// JSValue is the value of a JS property of the page. Value is only set for
+// strings, numbers and booleans.
+type JSValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// ErrInvalidJSPath is returned for JS properties which are not property paths
+var ErrInvalidJSPath = errors.New("InvalidJSPath")
+
+// jsKey is a key of a dotted path. As in Wappalyzer, keys are not only
+// identifiers (s_c_il.0, SQUARESPACE_ROLLUPS.squarespace-commerce, ...).
+var jsKey = regexp.MustCompile(`^[^.\[\]()'"\\\s]+`)
+
+// ParseJSPath splits a JS property path, such as jQuery.fn.jquery or
+// __APP__["config"][0].version, into its keys. Only keys, dots and brackets
+// holding a quoted key or an index are allowed, so that technology files
+// cannot run code in the scanned pages.
+func ParseJSPath(path string) ([]string, error) {
+	key := jsKey.FindString(path)
+	if key == "" {
+		return nil, ErrInvalidJSPath
+	}
+	keys := []string{key}
+	rest := path[len(key):]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			key = jsKey.FindString(rest[1:])
+			if key == "" {
+				return nil, ErrInvalidJSPath
+			}
+			keys = append(keys, key)
+			rest = rest[1+len(key):]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, ErrInvalidJSPath
+			}
+			bracketed, ok := bracketKey(rest[1:end])
+			if !ok {
+				return nil, ErrInvalidJSPath
+			}
+			keys = append(keys, bracketed)
+			rest = rest[end+1:]
+		default:
+			return nil, ErrInvalidJSPath
+		}
+	}
+	return keys, nil
+}
+
+// bracketKey returns the key of a bracket accessor : a quoted string
+// without quotes nor backslashes inside, or an index
+func bracketKey(inner string) (string, bool) {
+	if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+		key := inner[1 : len(inner)-1]
+		return key, !strings.ContainsAny(key, `'"\`)
+	}
+	if inner == "" {
+		return "", false
+	}
+	for _, c := range inner {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	return inner, true
+}
+
+// jsPropertiesScript is the only script run to read JS properties. It walks
+// the keys of each property from window, without evaluating anything, and
+// returns the type and value of the defined ones.
+const jsPropertiesScript = `(props) => {
+	const values = {};
+	for (const [prop, keys] of props) {
+		try {
+			let value = window;
+			for (const key of keys) {
+				if (value === null || value === undefined) {
+					break;
+				}
+				value = value[key];
+			}
+			if (value === null || value === undefined) {
+				continue;
+			}
+			const type = typeof value;
+			values[prop] = {type: type, value: ['string', 'number', 'boolean'].includes(type) ? String(value) : ''};
+		} catch (e) {
+			// Getters can throw, the property is then undefined
+		}
+	}
+	return values;
+}`
+
+// jsPropertiesArgs returns the argument of jsPropertiesScript for the valid
+// paths of jsProps
+func jsPropertiesArgs(jsProps []string) [][]interface{} {
+	args := make([][]interface{}, 0, len(jsProps))
+	for _, jsProp := range jsProps {
+		if keys, err := ParseJSPath(jsProp); err == nil {
+			args = append(args, []interface{}{jsProp, keys})
+		}
+	}
+	return args
+}
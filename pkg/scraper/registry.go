@@ -0,0 +1,82 @@
+package scraper
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Options are the settings given to the scraper factories. Each scraper
+// uses the ones it understands.
+type Options struct {
+	TimeoutSeconds        int
+	LoadingTimeoutSeconds int
+	UserAgent             string
+	Robots                *RobotsPolicy
+	Fetcher               *Fetcher
+	ScriptLoader          *ScriptLoader
+	Browser               BrowserOptions
+	// Resolver looks up the DNS records of the pages, none when nil
+	Resolver Resolver
+}
+
+// BrowserOptions are the settings of the scrapers driving a browser
+type BrowserOptions struct {
+	ControlURL           string
+	BinPath              string
+	UserDataDir          string
+	Flags                []string
+	ShowBrowser          bool
+	PoolSize             int
+	PageMaxAge           time.Duration
+	PageMaxUses          int
+	Incognito            bool
+	BlockedResourceTypes []string
+	BlockedDomains       []string
+}
+
+// Factory returns a new scraper, not initialized yet
+type Factory func(options *Options) (Scraper, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Factory)
+)
+
+// Register makes a scraper available under name. It panics when name is
+// already registered, like database/sql drivers.
+func Register(name string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if factory == nil {
+		panic("scraper: Register factory is nil")
+	}
+	if _, exists := registry[name]; exists {
+		panic("scraper: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New returns a new scraper of the one registered under name
+func New(name string, options *Options) (Scraper, error) {
+	registryLock.RLock()
+	factory, ok := registry[name]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, errors.New("UnknownScraper")
+	}
+	return factory(options)
+}
+
+// Names returns the sorted names of the registered scrapers
+func Names() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,212 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDNSTimeout = 2 * time.Second
+
+// Resolver looks up the records of a name by type : NS, MX, TXT, A, AAAA,
+// CNAME (the next name of the chain only), CAA or SOA (found in the
+// authority section for names which are not the apex of their zone).
+// Unknown names have no records and no error.
+type Resolver interface {
+	Lookup(name string, recordType string) ([]string, error)
+}
+
+// ErrUnknownRecordType is returned for the record types not listed above
+var ErrUnknownRecordType = errors.New("UnknownRecordType")
+
+// NetResolver queries a DNS server, the system resolver by default. The
+// system resolver only gives the canonical name at the end of a CNAME
+// chain, and has no lookup of CAA and SOA records, which are then skipped.
+type NetResolver struct {
+	Server   string
+	Timeout  time.Duration
+	resolver *net.Resolver
+}
+
+// NewNetResolver returns a resolver querying server (host or host:port), or
+// the system resolver when empty. A zero timeout means 2 seconds.
+func NewNetResolver(server string, timeout time.Duration) *NetResolver {
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	r := &NetResolver{Timeout: timeout, resolver: net.DefaultResolver}
+	if server == "" {
+		return r
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	r.Server = server
+	r.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+	return r
+}
+
+func (r *NetResolver) Lookup(name string, recordType string) (values []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+	switch recordType {
+	case "NS":
+		var nsSlice []*net.NS
+		nsSlice, err = r.resolver.LookupNS(ctx, name)
+		for _, ns := range nsSlice {
+			values = append(values, ns.Host)
+		}
+	case "MX":
+		var mxSlice []*net.MX
+		mxSlice, err = r.resolver.LookupMX(ctx, name)
+		for _, mx := range mxSlice {
+			values = append(values, mx.Host)
+		}
+	case "TXT":
+		values, err = r.resolver.LookupTXT(ctx, name)
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		var ips []net.IP
+		ips, err = r.resolver.LookupIP(ctx, network, name)
+		for _, ip := range ips {
+			values = append(values, ip.String())
+		}
+	case "CNAME":
+		if r.Server != "" {
+			return r.query(name, dnsTypeCNAME)
+		}
+		var cname string
+		cname, err = r.resolver.LookupCNAME(ctx, name)
+		// Names without CNAME are their own canonical name
+		if cname = strings.TrimSuffix(cname, "."); err == nil && !strings.EqualFold(cname, strings.TrimSuffix(name, ".")) {
+			values = append(values, cname)
+		}
+	case "CAA":
+		if r.Server != "" {
+			return r.query(name, dnsTypeCAA)
+		}
+	case "SOA":
+		if r.Server != "" {
+			return r.query(name, dnsTypeSOA)
+		}
+	default:
+		return nil, ErrUnknownRecordType
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return values, err
+}
+
+// query returns the records of type rtype of name, with the DNS client of
+// this package. Only the CNAME records of name itself are kept.
+func (r *NetResolver) query(name string, rtype uint16) (values []string, err error) {
+	records, err := queryDNS(r.Server, r.Timeout, name, rtype)
+	for _, record := range records {
+		if record.Type != rtype || (rtype == dnsTypeCNAME && !strings.EqualFold(record.Name, strings.TrimSuffix(name, "."))) {
+			continue
+		}
+		values = append(values, record.Data)
+	}
+	return values, err
+}
+
+type resolverEntry struct {
+	values  []string
+	err     error
+	expires time.Time
+	done    chan struct{}
+}
+
+// CachedResolver keeps the records looked up by the wrapped Resolver in
+// memory for TTL (forever when zero), and looks up the same records only
+// once when they are asked for at the same time. Failed lookups are not
+// cached, and expired records are removed at most once per TTL.
+type CachedResolver struct {
+	Resolver Resolver
+	TTL      time.Duration
+	lock     sync.Mutex
+	entries  map[string]*resolverEntry
+	purged   time.Time
+}
+
+// NewCachedResolver wraps resolver with a cache
+func NewCachedResolver(resolver Resolver, ttl time.Duration) *CachedResolver {
+	return &CachedResolver{Resolver: resolver, TTL: ttl, entries: make(map[string]*resolverEntry)}
+}
+
+func (r *CachedResolver) Lookup(name string, recordType string) ([]string, error) {
+	key := recordType + " " + strings.ToLower(strings.TrimSuffix(name, "."))
+	r.lock.Lock()
+	entry, ok := r.entries[key]
+	if ok {
+		select {
+		case <-entry.done:
+			ok = r.TTL == 0 || time.Now().Before(entry.expires)
+		default:
+			// Looked up by another goroutine
+		}
+	}
+	if !ok {
+		r.purgeExpired()
+		entry = &resolverEntry{done: make(chan struct{})}
+		r.entries[key] = entry
+		r.lock.Unlock()
+
+		entry.values, entry.err = r.Resolver.Lookup(name, recordType)
+		entry.expires = time.Now().Add(r.TTL)
+		if entry.err != nil {
+			r.lock.Lock()
+			if r.entries[key] == entry {
+				delete(r.entries, key)
+			}
+			r.lock.Unlock()
+		}
+		close(entry.done)
+	} else {
+		r.lock.Unlock()
+		<-entry.done
+	}
+	return append([]string(nil), entry.values...), entry.err
+}
+
+// purgeExpired removes the expired entries, unless done less than TTL ago.
+// It is called with the lock held.
+func (r *CachedResolver) purgeExpired() {
+	now := time.Now()
+	if r.TTL == 0 || now.Sub(r.purged) < r.TTL {
+		return
+	}
+	r.purged = now
+	for key, entry := range r.entries {
+		select {
+		case <-entry.done:
+			if now.After(entry.expires) {
+				delete(r.entries, key)
+			}
+		default:
+			// Still looked up
+		}
+	}
+}
+
+// FakeResolver answers with its records, by name then record type, without
+// network access. It is meant for tests.
+type FakeResolver map[string]map[string][]string
+
+func (r FakeResolver) Lookup(name string, recordType string) ([]string, error) {
+	return append([]string(nil), r[strings.ToLower(strings.TrimSuffix(name, "."))][recordType]...), nil
+}
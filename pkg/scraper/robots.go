@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Robots policy modes
+const (
+	// RobotsIgnore never reads robots.txt
+	RobotsIgnore = "ignore"
+	// RobotsCrawled respects robots.txt for the pages found while crawling,
+	// but not for the analyzed url itself
+	RobotsCrawled = "crawled"
+	// RobotsAlways respects robots.txt for every page
+	RobotsAlways = "always"
+)
+
+// Like Google, only the first 500KiB of robots.txt files are read
+const maxRobotsSize = 500 * 1024
+
+// ErrRobotsTxtBlocked is returned when robots.txt disallows a page
+var ErrRobotsTxtBlocked = errors.New("ErrRobotsTxtBlocked")
+
+// CrawlDelayer is implemented by scrapers knowing the robots.txt
+// Crawl-delay asked by the hosts they visit
+type CrawlDelayer interface {
+	CrawlDelay(u *url.URL) time.Duration
+}
+
+// RobotsPolicy decides, from the robots.txt file of each host, which pages
+// the scrapers may visit and how long to wait between two of them.
+// robots.txt files, and the errors met fetching them, are cached for TTL
+// (0 means forever).
+type RobotsPolicy struct {
+	Mode    string
+	TTL     time.Duration
+	fetcher *Fetcher
+	lock    sync.RWMutex
+	robots  map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	data    *robotstxt.RobotsData
+	err     error
+	fetched time.Time
+}
+
+// NewRobotsPolicy returns a RobotsPolicy reading robots.txt files with fetcher
+func NewRobotsPolicy(mode string, ttl time.Duration, fetcher *Fetcher) (*RobotsPolicy, error) {
+	switch mode {
+	case RobotsIgnore, RobotsCrawled, RobotsAlways:
+	default:
+		return nil, errors.New("UnknownRobotsMode")
+	}
+	return &RobotsPolicy{Mode: mode, TTL: ttl, fetcher: fetcher, robots: make(map[string]*robotsEntry)}, nil
+}
+
+// get returns the parsed robots.txt of the host of u
+func (p *RobotsPolicy) get(u *url.URL) (*robotstxt.RobotsData, error) {
+	p.lock.RLock()
+	entry, ok := p.robots[u.Host]
+	p.lock.RUnlock()
+	if ok && (p.TTL <= 0 || time.Since(entry.fetched) < p.TTL) {
+		return entry.data, entry.err
+	}
+	// no robots file cached
+	entry = &robotsEntry{fetched: time.Now()}
+	resource, err := p.fetcher.FetchPrefix(u.Scheme+"://"+u.Host+"/robots.txt", maxRobotsSize)
+	if err == nil {
+		body := resource.Body
+		// The last line of a truncated file may be cut in the middle of a rule
+		if len(body) == maxRobotsSize {
+			body = body[:bytes.LastIndexByte(body, '\n')+1]
+		}
+		entry.data, err = robotstxt.FromStatusAndBytes(resource.Status, body)
+	}
+	entry.err = err
+	p.lock.Lock()
+	p.robots[u.Host] = entry
+	p.lock.Unlock()
+	return entry.data, entry.err
+}
+
+// Allowed returns nil when userAgent may visit u at crawl depth, and
+// ErrRobotsTxtBlocked (or the error met reading robots.txt) otherwise.
+// Borrowed from Colly : https://github.com/gocolly/colly/blob/e664321b4e5b94ed568999d37a7cbdef81d61bda/colly.go#L777
+func (p *RobotsPolicy) Allowed(u *url.URL, depth int, userAgent string) error {
+	if p.Mode == RobotsIgnore || (p.Mode == RobotsCrawled && depth == 0) {
+		return nil
+	}
+	robot, err := p.get(u)
+	if err != nil {
+		return err
+	}
+
+	eu := u.EscapedPath()
+	if u.RawQuery != "" {
+		eu += "?" + u.Query().Encode()
+	}
+	if !robot.FindGroup(userAgent).Test(eu) {
+		return ErrRobotsTxtBlocked
+	}
+	return nil
+}
+
+// Sitemaps returns the Sitemap lines of the robots.txt of the host of u,
+// whatever the mode
+func (p *RobotsPolicy) Sitemaps(u *url.URL) []string {
+	robot, err := p.get(u)
+	if err != nil {
+		return nil
+	}
+	return robot.Sitemaps
+}
+
+// CrawlDelay returns the Crawl-delay asked to userAgent by the host of u,
+// 0 when there is none, robots.txt cannot be fetched or is ignored
+func (p *RobotsPolicy) CrawlDelay(u *url.URL, userAgent string) time.Duration {
+	if p.Mode == RobotsIgnore {
+		return 0
+	}
+	robot, err := p.get(u)
+	if err != nil {
+		return 0
+	}
+	return robot.FindGroup(userAgent).CrawlDelay
+}
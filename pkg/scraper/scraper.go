@@ -1,25 +1,36 @@
 package scraper
 
-import (
-	"net"
-	"net/url"
-	"strings"
-)
-
 type ScrapedURL struct {
 	URL    string `json:"url,omitempty"`
 	Status int    `json:"status,omitempty"`
+	// TLS is only set for the pages served over TLS
+	TLS *ScrapedTLS `json:"tls,omitempty"`
+}
+
+// ScrapedResource is a response received while loading the page, the page
+// itself or one of its subresources
+type ScrapedResource struct {
+	URL      string              `json:"url"`
+	Status   int                 `json:"status,omitempty"`
+	Headers  map[string][]string `json:"headers,omitempty"`
+	MimeType string              `json:"mimeType,omitempty"`
+	RemoteIP string              `json:"remoteIP,omitempty"`
+	Protocol string              `json:"protocol,omitempty"`
 }
 
 type ScrapedData struct {
-	URLs       ScrapedURL
-	HTML       string
-	Headers    map[string][]string
-	Scripts    []string
-	Cookies    map[string]string
-	Meta       map[string][]string
-	DNS        map[string][]string
-	CertIssuer []string
+	URLs       ScrapedURL          `json:"urls"`
+	HTML       string              `json:"html"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Scripts    []string            `json:"scripts,omitempty"`
+	XHR        []string            `json:"xhr,omitempty"`
+	Cookies    map[string]string   `json:"cookies,omitempty"`
+	Meta       map[string][]string `json:"meta,omitempty"`
+	DNS        map[string][]string `json:"dns,omitempty"`
+	CertIssuer []string            `json:"certIssuer,omitempty"`
+	Resources  []ScrapedResource   `json:"resources,omitempty"`
+	// ScriptContents are only filled by scrapers with a ScriptLoader
+	ScriptContents []ScrapedScript `json:"scriptContents,omitempty"`
 }
 
 // Scraper is an interface for different scrapping brower (colly, rod)
@@ -28,26 +39,16 @@ type Scraper interface {
 	CanRenderPage() bool
 	Scrape(paramURL string) (*ScrapedData, error)
 	EvalJS(jsProp string) (*string, error)
+	// EvalJSProperties returns the values of the JS properties defined in
+	// the page, in one round-trip
+	EvalJSProperties(jsProps []string) (map[string]JSValue, error)
 	SetDepth(depth int)
+	Close() error
 }
 
-func scrapeDNS(paramURL string) map[string][]string {
-	scrapedDNS := make(map[string][]string)
-	u, _ := url.Parse(paramURL)
-	parts := strings.Split(u.Hostname(), ".")
-	domain := parts[len(parts)-2] + "." + parts[len(parts)-1]
-	nsSlice, _ := net.LookupNS(domain)
-	for _, ns := range nsSlice {
-		scrapedDNS["NS"] = append(scrapedDNS["NS"], string(ns.Host))
-	}
-	mxSlice, _ := net.LookupMX(domain)
-	for _, mx := range mxSlice {
-		scrapedDNS["MX"] = append(scrapedDNS["MX"], string(mx.Host))
-	}
-	txtSlice, _ := net.LookupTXT(domain)
-	scrapedDNS["TXT"] = append(scrapedDNS["TXT"], txtSlice...)
-	cname, _ := net.LookupCNAME(domain)
-	scrapedDNS["CNAME"] = append(scrapedDNS["CNAME"], cname)
-
-	return scrapedDNS
+// ConcurrentScraper is implemented by scrapers able to scrape (and eval JS
+// on) several pages at the same time. The pages of the other scrapers are
+// analyzed one at a time.
+type ConcurrentScraper interface {
+	Concurrent() bool
 }
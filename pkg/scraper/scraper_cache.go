@@ -0,0 +1,305 @@
+package scraper
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Cache modes
+const (
+	// CacheReadWrite serves fresh cached pages and scrapes (then stores) the others
+	CacheReadWrite = "readwrite"
+	// CacheRecord always scrapes and overwrites the cached pages
+	CacheRecord = "record"
+	// CacheReplay only serves cached pages, without any network access
+	CacheReplay = "replay"
+)
+
+// ErrCacheMiss is returned in replay mode when an URL is not in the cache
+var ErrCacheMiss = errors.New("CacheMiss")
+
+type cacheEntry struct {
+	URL           string             `json:"url"`
+	Time          time.Time          `json:"time"`
+	CanRenderPage bool               `json:"canRenderPage"`
+	Data          *ScrapedData       `json:"data"`
+	JS            map[string]JSValue `json:"-"`
+	// Undefined are the JS properties known to be undefined in the page
+	Undefined map[string]struct{} `json:"-"`
+	// live is set when the page was just scraped by the wrapped scraper,
+	// which can then evaluate the JS properties missing from the cache
+	live bool
+}
+
+type cachedJS struct {
+	Prop      string `json:"prop"`
+	Type      string `json:"type,omitempty"`
+	Value     string `json:"value"`
+	Undefined bool   `json:"undefined,omitempty"`
+}
+
+// CachedScraper persists the data scraped by the wrapped Scraper on disk,
+// keyed by URL, so that pages can be analyzed again without network access
+type CachedScraper struct {
+	Scraper Scraper
+	Dir     string
+	TTL     time.Duration
+	Mode    string
+	current *cacheEntry
+	lock    sync.RWMutex
+}
+
+// NewCachedScraper wraps s with a cache stored in dir. A zero ttl means
+// cached pages never expire.
+func NewCachedScraper(s Scraper, dir string, ttl time.Duration, mode string) (*CachedScraper, error) {
+	switch mode {
+	case CacheReadWrite, CacheRecord, CacheReplay:
+	default:
+		log.Errorf("Unknown cache mode %s", mode)
+		return nil, errors.New("UnknownCacheMode")
+	}
+	return &CachedScraper{Scraper: s, Dir: dir, TTL: ttl, Mode: mode}, nil
+}
+
+// Init creates the cache directory and initializes the wrapped scraper,
+// unless in replay mode where it is never used
+func (s *CachedScraper) Init() error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	if s.Mode == CacheReplay {
+		log.Infof("Replaying scraped pages from %s", s.Dir)
+		return nil
+	}
+	return s.Scraper.Init()
+}
+
+func (s *CachedScraper) CanRenderPage() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.current != nil {
+		return s.current.CanRenderPage
+	}
+	return s.Scraper.CanRenderPage()
+}
+
+func (s *CachedScraper) SetDepth(depth int) {
+	s.Scraper.SetDepth(depth)
+}
+
+// Close closes the wrapped scraper, which is not initialized in replay mode
+func (s *CachedScraper) Close() error {
+	if s.Mode == CacheReplay {
+		return nil
+	}
+	return s.Scraper.Close()
+}
+
+func (s *CachedScraper) Scrape(paramURL string) (*ScrapedData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current = nil
+
+	if s.Mode != CacheRecord {
+		entry, err := s.load(paramURL)
+		if err == nil && (s.Mode == CacheReplay || s.TTL == 0 || time.Since(entry.Time) < s.TTL) {
+			log.Infof("Serving %s from cache", paramURL)
+			s.current = entry
+			return entry.Data, nil
+		}
+		if s.Mode == CacheReplay {
+			log.Errorf("%s not found in cache", paramURL)
+			return &ScrapedData{}, ErrCacheMiss
+		}
+	}
+
+	scraped, err := s.Scraper.Scrape(paramURL)
+	if err != nil {
+		return scraped, err
+	}
+	entry := &cacheEntry{
+		URL:           paramURL,
+		Time:          time.Now(),
+		CanRenderPage: s.Scraper.CanRenderPage(),
+		Data:          scraped,
+		JS:            make(map[string]JSValue),
+		Undefined:     make(map[string]struct{}),
+		live:          true,
+	}
+	if err := s.store(entry); err != nil {
+		log.Errorf("Couldn't cache %s : %v", paramURL, err)
+	}
+	s.current = entry
+	return scraped, nil
+}
+
+// EvalJS returns the cached value of the JS property for the current page,
+// see EvalJSProperties
+func (s *CachedScraper) EvalJS(jsProp string) (*string, error) {
+	values, err := s.EvalJSProperties([]string{jsProp})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[jsProp]
+	if !ok {
+		return nil, errors.New("UndefinedProperty")
+	}
+	return &value.Value, nil
+}
+
+// EvalJSProperties returns the cached values of the JS properties for the
+// current page. The others are evaluated (and cached, undefined ones too)
+// by the wrapped scraper, only when it has just scraped the page : pages
+// served from the cache are not loaded by the wrapped scraper, which would
+// evaluate the properties of another page.
+func (s *CachedScraper) EvalJSProperties(jsProps []string) (map[string]JSValue, error) {
+	s.lock.RLock()
+	entry := s.current
+	values := make(map[string]JSValue)
+	var missing []string
+	if entry != nil {
+		for _, jsProp := range jsProps {
+			if value, ok := entry.JS[jsProp]; ok {
+				values[jsProp] = value
+			} else if _, ok := entry.Undefined[jsProp]; !ok {
+				missing = append(missing, jsProp)
+			}
+		}
+	}
+	s.lock.RUnlock()
+	if entry == nil {
+		return nil, errors.New("NoPageScraped")
+	}
+	if len(missing) == 0 || !entry.live || !entry.CanRenderPage {
+		return values, nil
+	}
+
+	evaluated, err := s.Scraper.EvalJSProperties(missing)
+	if err != nil {
+		return values, err
+	}
+	s.cacheJS(entry, missing, evaluated)
+	for jsProp, value := range evaluated {
+		values[jsProp] = value
+	}
+	return values, nil
+}
+
+// cacheJS adds the values of the evaluated JS properties to entry and its
+// file, those without value being undefined
+func (s *CachedScraper) cacheJS(entry *cacheEntry, evaluated []string, values map[string]JSValue) {
+	lines := make([]*cachedJS, 0, len(evaluated))
+	s.lock.Lock()
+	for _, jsProp := range evaluated {
+		if value, ok := values[jsProp]; ok {
+			entry.JS[jsProp] = value
+			lines = append(lines, &cachedJS{Prop: jsProp, Type: value.Type, Value: value.Value})
+		} else {
+			entry.Undefined[jsProp] = struct{}{}
+			lines = append(lines, &cachedJS{Prop: jsProp, Undefined: true})
+		}
+	}
+	s.lock.Unlock()
+	if err := s.appendJS(entry.URL, lines); err != nil {
+		log.Errorf("Couldn't cache JS properties of %s : %v", entry.URL, err)
+	}
+}
+
+// CrawlDelay returns the Crawl-delay known by the wrapped scraper, 0 in
+// replay mode where no request is sent
+func (s *CachedScraper) CrawlDelay(u *url.URL) time.Duration {
+	if delayer, ok := s.Scraper.(CrawlDelayer); ok && s.Mode != CacheReplay {
+		return delayer.CrawlDelay(u)
+	}
+	return 0
+}
+
+func (s *CachedScraper) path(paramURL string, suffix string) string {
+	hash := sha256.Sum256([]byte(paramURL))
+	return filepath.Join(s.Dir, hex.EncodeToString(hash[:])+suffix)
+}
+
+func (s *CachedScraper) load(paramURL string) (*cacheEntry, error) {
+	content, err := ioutil.ReadFile(s.path(paramURL, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(content, entry); err != nil {
+		return nil, err
+	}
+	if entry.URL != paramURL || entry.Data == nil {
+		return nil, errors.New("CacheEntryMismatch")
+	}
+
+	entry.JS = make(map[string]JSValue)
+	entry.Undefined = make(map[string]struct{})
+	file, err := os.Open(s.path(paramURL, ".js.jsonl"))
+	if err != nil {
+		return entry, nil
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		js := &cachedJS{}
+		if json.Unmarshal(scanner.Bytes(), js) != nil {
+			continue
+		}
+		if js.Undefined {
+			entry.Undefined[js.Prop] = struct{}{}
+		} else {
+			entry.JS[js.Prop] = JSValue{Type: js.Type, Value: js.Value}
+		}
+	}
+	return entry, nil
+}
+
+func (s *CachedScraper) store(entry *cacheEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Write then rename so that a concurrent reader never sees a partial entry
+	tmp := s.path(entry.URL, ".json.tmp")
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path(entry.URL, ".json")); err != nil {
+		return err
+	}
+	if err = os.Remove(s.path(entry.URL, ".js.jsonl")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *CachedScraper) appendJS(paramURL string, lines []*cachedJS) error {
+	var content []byte
+	for _, js := range lines {
+		line, err := json.Marshal(js)
+		if err != nil {
+			return err
+		}
+		content = append(append(content, line...), '\n')
+	}
+	file, err := os.OpenFile(s.path(paramURL, ".js.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(content)
+	return err
+}
@@ -5,7 +5,7 @@ import (
 	"errors"
 	"net"
 	"net/http"
-	"strings"
+	"net/url"
 	"time"
 
 	"github.com/gocolly/colly"
@@ -14,20 +14,44 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+func init() {
+	Register("colly", func(options *Options) (Scraper, error) {
+		return &CollyScraper{
+			TimeoutSeconds:        options.TimeoutSeconds,
+			LoadingTimeoutSeconds: options.LoadingTimeoutSeconds,
+			UserAgent:             options.UserAgent,
+			Robots:                options.Robots,
+			ScriptLoader:          options.ScriptLoader,
+			Resolver:              options.Resolver,
+		}, nil
+	})
+}
+
+// CollyScraper scrapes each page with its own collector, so that scrapes do
+// not share state and can run concurrently, but with the same transport and
+// its pool of connections
 type CollyScraper struct {
-	Collector             *colly.Collector
 	Transport             *http.Transport
-	Response              *http.Response
 	TimeoutSeconds        int
 	LoadingTimeoutSeconds int
 	UserAgent             string
-	depth                 int
+	Robots                *RobotsPolicy
+	// Resolver looks up the DNS records of the pages, none when nil
+	Resolver Resolver
+	// ScriptLoader, when set, downloads the scripts of the scraped pages
+	ScriptLoader *ScriptLoader
+	depth        int
 }
 
 func (s *CollyScraper) CanRenderPage() bool {
 	return false
 }
 
+// Concurrent is true, each scrape has its own collector
+func (s *CollyScraper) Concurrent() bool {
+	return true
+}
+
 func (s *CollyScraper) SetDepth(depth int) {
 	s.depth = depth
 }
@@ -44,22 +68,24 @@ func (s *CollyScraper) Init() error {
 		ExpectContinueTimeout: time.Duration(s.TimeoutSeconds) * time.Second,
 		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
 	}
-
-	s.Collector = colly.NewCollector()
-	s.Collector.UserAgent = s.UserAgent
-	//s.Collector.WithTransport(s.Transport)
-
-	setResp := func(r *http.Response) {
-		s.Response = r
+	if s.Robots == nil {
+		s.Robots, _ = NewRobotsPolicy(RobotsCrawled, 0, NewFetcher(s.TimeoutSeconds, s.UserAgent, false))
 	}
-
-	s.Collector.WithTransport(NewGoWapTransport(s.Transport, setResp))
-
-	extensions.Referer(s.Collector)
-
 	return nil
 }
 
+// newCollector returns the collector of a single scrape. setResp receives
+// the responses of the transport, redirects included.
+func (s *CollyScraper) newCollector(setResp func(resp *http.Response)) *colly.Collector {
+	collector := colly.NewCollector()
+	collector.UserAgent = s.UserAgent
+	collector.WithTransport(NewGoWapTransport(s.Transport, setResp))
+	// robots.txt is checked by the RobotsPolicy, shared with other scrapers
+	collector.IgnoreRobotsTxt = true
+	extensions.Referer(collector)
+	return collector
+}
+
 type GoWapTransport struct {
 	*http.Transport
 	respCallBack func(resp *http.Response)
@@ -78,55 +104,64 @@ func (gt *GoWapTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 func (s *CollyScraper) Scrape(paramURL string) (*ScrapedData, error) {
 
 	scraped := &ScrapedData{}
-	scraped.DNS = scrapeDNS(paramURL)
-
-	if s.depth > 0 {
-		s.Collector.IgnoreRobotsTxt = false
+	if s.Resolver != nil {
+		scraped.DNS = scrapeDNS(s.Resolver, paramURL)
 	}
 
-	s.Collector.OnResponse(func(r *colly.Response) {
-		// log.Infof("Visited %s", r.Request.URL)
-		scraped.URLs = ScrapedURL{r.Request.URL.String(), r.StatusCode}
-		scraped.Headers = make(map[string][]string)
-		for k, v := range *r.Headers {
-			lowerCaseKey := strings.ToLower(k)
-			scraped.Headers[lowerCaseKey] = v
-		}
-
-		scraped.HTML = string(r.Body)
-
-		scraped.Cookies = make(map[string]string)
-		for _, cookie := range scraped.Headers["set-cookie"] {
-			keyValues := strings.Split(cookie, ";")
-			for _, keyValueString := range keyValues {
-				keyValueSlice := strings.Split(keyValueString, "=")
-				if len(keyValueSlice) > 1 {
-					key, value := keyValueSlice[0], keyValueSlice[1]
-					scraped.Cookies[key] = value
-				}
-			}
+	if parsedURL, err := url.Parse(paramURL); err == nil {
+		if err := s.Robots.Allowed(parsedURL, s.depth, s.UserAgent); err != nil {
+			return scraped, err
 		}
+	}
 
-		if s.Response != nil && s.Response.TLS != nil && len(s.Response.TLS.PeerCertificates) > 0 {
-			if len(s.Response.TLS.PeerCertificates[0].Issuer.Organization) > 0 {
-				scraped.CertIssuer = append(scraped.CertIssuer, s.Response.TLS.PeerCertificates[0].Issuer.Organization...)
-			}
-			if len(s.Response.TLS.PeerCertificates[0].Issuer.CommonName) > 0 {
-				scraped.CertIssuer = append(scraped.CertIssuer, s.Response.TLS.PeerCertificates[0].Issuer.CommonName)
-			}
+	var inline []string
+	var tlsState *tls.ConnectionState
+	collector := s.newCollector(func(resp *http.Response) {
+		if resp != nil {
+			tlsState = resp.TLS
 		}
 	})
+	collector.OnResponse(func(r *colly.Response) {
+		extractResponse(scraped, r.Request.URL.String(), r.StatusCode, *r.Headers)
+		inline = extractHTML(scraped, string(r.Body))
 
-	s.Collector.OnHTML("script", func(e *colly.HTMLElement) {
-		scraped.Scripts = append(scraped.Scripts, e.Attr("src"))
+		if tlsState != nil {
+			scraped.URLs.TLS = extractTLS(tlsState)
+		}
+		if tlsState != nil && len(tlsState.PeerCertificates) > 0 {
+			issuer := tlsState.PeerCertificates[0].Issuer
+			appendCertIssuer(scraped, issuer.Organization...)
+			appendCertIssuer(scraped, issuer.CommonName)
+		}
 	})
 
-	err := s.Collector.Visit(paramURL)
+	err := collector.Visit(paramURL)
+	if err == nil && s.ScriptLoader != nil {
+		s.ScriptLoader.Load(scraped, inline)
+	}
 
 	return scraped, err
 }
 
+// CrawlDelay returns the robots.txt Crawl-delay of the host of u
+func (s *CollyScraper) CrawlDelay(u *url.URL) time.Duration {
+	return s.Robots.CrawlDelay(u, s.UserAgent)
+}
+
+// Close closes the idle connections
+func (s *CollyScraper) Close() error {
+	if s.Transport != nil {
+		s.Transport.CloseIdleConnections()
+	}
+	return nil
+}
+
 // Colly cannot eval JS
 func (s *CollyScraper) EvalJS(jsProp string) (*string, error) {
 	return nil, errors.New("NotImplemented")
 }
+
+// Colly cannot eval JS
+func (s *CollyScraper) EvalJSProperties(jsProps []string) (map[string]JSValue, error) {
+	return nil, errors.New("NotImplemented")
+}
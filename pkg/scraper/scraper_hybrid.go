@@ -0,0 +1,296 @@
+package scraper
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons for rendering a page in the browser
+const (
+	EscalationEmptyBody    = "emptyBody"
+	EscalationSPAMarkers   = "spaMarkers"
+	EscalationTechnologies = "technologies"
+)
+
+// spaMarkers are the markup of single page applications rendered by scripts
+var spaMarkers = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)<div[^>]+id=["']?(root|app|__next|__nuxt|___gatsby|svelte)["']?[^>]*>\s*</div>`),
+	regexp.MustCompile(`(?i)<[^>]+\s(ng-app|ng-version|data-reactroot|data-server-rendered)[\s=>]`),
+	regexp.MustCompile(`(?i)<noscript>[^<]*(enable|requires?|need)[^<]*javascript`),
+}
+
+func init() {
+	Register("hybrid", func(options *Options) (Scraper, error) {
+		// The scripts are loaded once, from the merged data
+		subOptions := *options
+		subOptions.ScriptLoader = nil
+		static, err := New("colly", &subOptions)
+		if err != nil {
+			return nil, err
+		}
+		browser, err := New("rod", &subOptions)
+		if err != nil {
+			return nil, err
+		}
+		return &HybridScraper{Static: static, Browser: browser, ScriptLoader: options.ScriptLoader}, nil
+	})
+}
+
+// HybridStats counts the pages scraped by a HybridScraper, and how many of
+// them were rendered in the browser, by reason
+type HybridStats struct {
+	Pages     int            `json:"pages"`
+	Escalated int            `json:"escalated"`
+	Reasons   map[string]int `json:"reasons,omitempty"`
+}
+
+// HybridScraper fetches the pages with the Static scraper, and only renders
+// them with the Browser scraper when they look built by scripts (empty body,
+// markers of single page applications) or when Escalate asks for it. The
+// data of both scrapes are then merged. The Browser scraper is initialized
+// on the first rendered page, scans which render none never launch it.
+type HybridScraper struct {
+	Static  Scraper
+	Browser Scraper
+	// Escalate, when set, returns the reason to render the statically
+	// scraped page, or an empty string
+	Escalate func(scraped *ScrapedData) string
+	// ScriptLoader, when set, downloads the scripts of the scraped pages
+	ScriptLoader *ScriptLoader
+	rendered     bool
+	stats        HybridStats
+	lock         sync.Mutex
+	browserOnce  sync.Once
+	browserErr   error
+	browserUp    bool
+}
+
+// Init initializes the static scraper, the browser is initialized when
+// the first page is rendered
+func (s *HybridScraper) Init() error {
+	log.Infoln("Hybrid initialization")
+	return s.Static.Init()
+}
+
+// initBrowser initializes the Browser scraper once
+func (s *HybridScraper) initBrowser() error {
+	s.browserOnce.Do(func() {
+		log.Infoln("Hybrid scraper launching the browser")
+		s.browserErr = s.Browser.Init()
+		s.lock.Lock()
+		s.browserUp = s.browserErr == nil
+		s.lock.Unlock()
+	})
+	return s.browserErr
+}
+
+// CanRenderPage is true when the current page was rendered in the browser
+func (s *HybridScraper) CanRenderPage() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rendered
+}
+
+func (s *HybridScraper) SetDepth(depth int) {
+	s.Static.SetDepth(depth)
+	s.Browser.SetDepth(depth)
+}
+
+// Since returns the stats of the pages scraped since before was taken
+func (stats HybridStats) Since(before HybridStats) HybridStats {
+	since := HybridStats{Pages: stats.Pages - before.Pages, Escalated: stats.Escalated - before.Escalated}
+	for reason, count := range stats.Reasons {
+		if count -= before.Reasons[reason]; count > 0 {
+			if since.Reasons == nil {
+				since.Reasons = make(map[string]int)
+			}
+			since.Reasons[reason] = count
+		}
+	}
+	return since
+}
+
+// Stats returns how many pages were rendered in the browser
+func (s *HybridScraper) Stats() HybridStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := s.stats
+	stats.Reasons = make(map[string]int)
+	for reason, count := range s.stats.Reasons {
+		stats.Reasons[reason] = count
+	}
+	return stats
+}
+
+// Close logs the escalation stats and closes both scrapers
+func (s *HybridScraper) Close() error {
+	stats := s.Stats()
+	log.Infof("Hybrid scraper rendered %d of %d pages in the browser %v", stats.Escalated, stats.Pages, stats.Reasons)
+	err := s.Static.Close()
+	s.lock.Lock()
+	browserUp := s.browserUp
+	s.lock.Unlock()
+	if !browserUp {
+		return err
+	}
+	if browserErr := s.Browser.Close(); err == nil {
+		err = browserErr
+	}
+	return err
+}
+
+func (s *HybridScraper) Scrape(paramURL string) (*ScrapedData, error) {
+	s.lock.Lock()
+	s.rendered = false
+	s.lock.Unlock()
+
+	scraped, err := s.Static.Scrape(paramURL)
+	if err != nil {
+		return scraped, err
+	}
+	reason := renderingSignal(scraped)
+	if reason == "" && s.Escalate != nil {
+		reason = s.Escalate(scraped)
+	}
+	s.count(reason)
+
+	if reason != "" {
+		log.Debugf("Rendering %s in the browser : %s", paramURL, reason)
+		var rendered *ScrapedData
+		err := s.initBrowser()
+		if err == nil {
+			rendered, err = s.Browser.Scrape(paramURL)
+		}
+		if err != nil {
+			log.Warnf("Couldn't render %s, keeping the static scrape : %v", paramURL, err)
+		} else {
+			scraped = mergeScraped(scraped, rendered)
+			s.lock.Lock()
+			s.rendered = true
+			s.lock.Unlock()
+		}
+	}
+
+	if s.ScriptLoader != nil {
+		inline := extractHTML(&ScrapedData{URLs: scraped.URLs}, scraped.HTML)
+		s.ScriptLoader.Load(scraped, inline)
+	}
+	return scraped, nil
+}
+
+// count records a scraped page, escalated when reason is not empty
+func (s *HybridScraper) count(reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats.Pages++
+	if reason == "" {
+		return
+	}
+	s.stats.Escalated++
+	if s.stats.Reasons == nil {
+		s.stats.Reasons = make(map[string]int)
+	}
+	s.stats.Reasons[reason]++
+}
+
+// CrawlDelay returns the robots.txt Crawl-delay of the host of u, known by
+// the static scraper
+func (s *HybridScraper) CrawlDelay(u *url.URL) time.Duration {
+	if delayer, ok := s.Static.(CrawlDelayer); ok {
+		return delayer.CrawlDelay(u)
+	}
+	return 0
+}
+
+// EvalJS is only possible on the pages rendered in the browser
+func (s *HybridScraper) EvalJS(jsProp string) (*string, error) {
+	if !s.CanRenderPage() {
+		return nil, errors.New("NotImplemented")
+	}
+	return s.Browser.EvalJS(jsProp)
+}
+
+// EvalJSProperties is only possible on the pages rendered in the browser
+func (s *HybridScraper) EvalJSProperties(jsProps []string) (map[string]JSValue, error) {
+	if !s.CanRenderPage() {
+		return nil, errors.New("NotImplemented")
+	}
+	return s.Browser.EvalJSProperties(jsProps)
+}
+
+// renderingSignal returns the reason to render a page whose content is
+// built by scripts, or an empty string
+func renderingSignal(scraped *ScrapedData) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(scraped.HTML))
+	if err != nil {
+		return ""
+	}
+	body := doc.Find("body").Clone()
+	body.Find("script, noscript, style, template").Remove()
+	if strings.TrimSpace(body.Text()) == "" {
+		return EscalationEmptyBody
+	}
+	for _, marker := range spaMarkers {
+		if marker.MatchString(scraped.HTML) {
+			return EscalationSPAMarkers
+		}
+	}
+	return ""
+}
+
+// mergeScraped returns the rendered data completed by the static ones : the
+// rendered HTML, cookies, resources and XHR, with the scripts, meta and
+// cookies removed by the scripts of the page
+func mergeScraped(static, rendered *ScrapedData) *ScrapedData {
+	merged := *rendered
+	if len(merged.Headers) == 0 {
+		merged.Headers = static.Headers
+	}
+	if merged.URLs.TLS == nil {
+		merged.URLs.TLS = static.URLs.TLS
+	}
+	if len(merged.DNS) == 0 {
+		merged.DNS = static.DNS
+	}
+	merged.Scripts = appendMissing(append([]string(nil), rendered.Scripts...), static.Scripts...)
+	merged.CertIssuer = appendMissing(append([]string(nil), rendered.CertIssuer...), static.CertIssuer...)
+	merged.Cookies = make(map[string]string)
+	for name, value := range static.Cookies {
+		merged.Cookies[name] = value
+	}
+	for name, value := range rendered.Cookies {
+		merged.Cookies[name] = value
+	}
+	merged.Meta = make(map[string][]string)
+	for name, values := range rendered.Meta {
+		merged.Meta[name] = append([]string(nil), values...)
+	}
+	for name, values := range static.Meta {
+		merged.Meta[name] = appendMissing(merged.Meta[name], values...)
+	}
+	return &merged
+}
+
+// appendMissing appends the values not already in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, known := range list {
+			if known == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -1,32 +1,83 @@
 package scraper
 
 import (
-	"crypto/tls"
+	"context"
 	"errors"
-	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/go-rod/rod/lib/launcher"
-	"github.com/temoto/robotstxt"
+	"github.com/go-rod/rod/lib/launcher/flags"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const reconnectAttempts = 3
+
+func init() {
+	Register("rod", func(options *Options) (Scraper, error) {
+		browser := options.Browser
+		return &RodScraper{
+			TimeoutSeconds:        options.TimeoutSeconds,
+			LoadingTimeoutSeconds: options.LoadingTimeoutSeconds,
+			UserAgent:             options.UserAgent,
+			Robots:                options.Robots,
+			ControlURL:            browser.ControlURL,
+			BinPath:               browser.BinPath,
+			UserDataDir:           browser.UserDataDir,
+			Flags:                 browser.Flags,
+			ShowBrowser:           browser.ShowBrowser,
+			PoolSize:              browser.PoolSize,
+			PageMaxAge:            browser.PageMaxAge,
+			PageMaxUses:           browser.PageMaxUses,
+			Incognito:             browser.Incognito,
+			BlockedResourceTypes:  browser.BlockedResourceTypes,
+			BlockedDomains:        browser.BlockedDomains,
+			ScriptLoader:          options.ScriptLoader,
+			Resolver:              options.Resolver,
+		}, nil
+	})
+}
+
 type RodScraper struct {
 	Browser               *rod.Browser
 	Page                  *rod.Page
 	TimeoutSeconds        int
 	LoadingTimeoutSeconds int
 	UserAgent             string
-	protoUserAgent        *proto.NetworkSetUserAgentOverride
-	lock                  *sync.RWMutex
-	robotsMap             map[string]*robotstxt.RobotsData
-	depth                 int
+	Robots                *RobotsPolicy
+	// ControlURL connects to a running browser (DevTools websocket URL or
+	// host:port) instead of launching one
+	ControlURL string
+	// BinPath, UserDataDir, Flags ("--name=value") and ShowBrowser set how
+	// the local browser is launched
+	BinPath     string
+	UserDataDir string
+	Flags       []string
+	ShowBrowser bool
+	// Tabs are reused between scrapes : PoolSize idle tabs are kept, each one
+	// for PageMaxAge and PageMaxUses scrapes at most (0 means no limit)
+	PoolSize    int
+	PageMaxAge  time.Duration
+	PageMaxUses int
+	Incognito   bool
+	// Requests of the BlockedResourceTypes ("Image", "Font", ...) or to
+	// the BlockedDomains (and their subdomains) are not sent
+	BlockedResourceTypes []string
+	BlockedDomains       []string
+	// Resolver looks up the DNS records of the pages, none when nil
+	Resolver Resolver
+	// ScriptLoader, when set, downloads the scripts of the scraped pages
+	ScriptLoader   *ScriptLoader
+	protoUserAgent *proto.NetworkSetUserAgentOverride
+	launcher       *launcher.Launcher
+	disconnect     context.CancelFunc
+	pool           *pagePool
+	current        *pooledPage
+	depth          int
 }
 
 func (s *RodScraper) CanRenderPage() bool {
@@ -39,18 +90,124 @@ func (s *RodScraper) SetDepth(depth int) {
 
 func (s *RodScraper) Init() error {
 	log.Infoln("Rod initialization")
-	return rod.Try(func() {
-		path, _ := launcher.LookPath()
-		u := launcher.New().Bin(path).NoSandbox(true).MustLaunch()
-		s.lock = &sync.RWMutex{}
-		s.robotsMap = make(map[string]*robotstxt.RobotsData)
-		s.protoUserAgent = &proto.NetworkSetUserAgentOverride{UserAgent: s.UserAgent}
-		s.Browser = rod.
-			New().
-			ControlURL(u).
-			MustConnect().
-			MustIgnoreCertErrors(true)
+	if s.Robots == nil {
+		s.Robots, _ = NewRobotsPolicy(RobotsCrawled, 0, NewFetcher(s.TimeoutSeconds, s.UserAgent, false))
+	}
+	s.protoUserAgent = &proto.NetworkSetUserAgentOverride{UserAgent: s.UserAgent}
+	return s.launch()
+}
+
+// launch starts the browser, or connects to the remote one, and its pool of tabs
+func (s *RodScraper) launch() (err error) {
+	controlURL := s.ControlURL
+	switch {
+	case controlURL == "":
+		s.launcher = s.newLauncher()
+		if controlURL, err = s.launcher.Launch(); err != nil {
+			return err
+		}
+	case !strings.HasPrefix(controlURL, "ws://") && !strings.HasPrefix(controlURL, "wss://"):
+		// The websocket URL changes each time the remote browser restarts
+		if controlURL, err = launcher.ResolveURL(controlURL); err != nil {
+			return err
+		}
+	}
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	browser := rod.New().Context(ctx).ControlURL(controlURL)
+	err = rod.Try(func() {
+		browser.MustConnect().MustIgnoreCertErrors(true)
 	})
+	if err != nil {
+		disconnect()
+		return err
+	}
+	s.Browser = browser
+	s.disconnect = disconnect
+	s.pool = newPagePool(s.Browser, s.Incognito, s.PoolSize, s.PageMaxAge, s.PageMaxUses)
+	s.pool.setup = s.setupPage
+	return nil
+}
+
+// newLauncher returns the launcher of the local browser
+func (s *RodScraper) newLauncher() *launcher.Launcher {
+	path := s.BinPath
+	if path == "" {
+		path, _ = launcher.LookPath()
+	}
+	l := launcher.New().Bin(path).NoSandbox(true).Headless(!s.ShowBrowser)
+	if s.UserDataDir != "" {
+		l = l.UserDataDir(s.UserDataDir)
+	}
+	for _, flag := range s.Flags {
+		name, value := flag, ""
+		if i := strings.Index(flag, "="); i >= 0 {
+			name, value = flag[:i], flag[i+1:]
+		}
+		if value == "" {
+			l = l.Set(flags.Flag(name))
+		} else {
+			l = l.Set(flags.Flag(name), value)
+		}
+	}
+	return l
+}
+
+// stop disconnects from the browser, and kills it when launched locally
+func (s *RodScraper) stop() {
+	s.current = nil
+	s.Page = nil
+	s.pool.close()
+	if s.launcher != nil {
+		_ = s.Browser.Close()
+		s.launcher.Kill()
+		// Cleanup removes the user data directory, given ones are kept
+		if s.UserDataDir == "" {
+			s.launcher.Cleanup()
+		}
+	}
+	s.disconnect()
+	s.Browser = nil
+}
+
+// ensureBrowser launches the browser again when it crashed, or reconnects
+// to the remote browser when it restarted
+func (s *RodScraper) ensureBrowser() (err error) {
+	if s.Browser == nil {
+		return errors.New("BrowserNotLaunched")
+	}
+	if _, err = (proto.BrowserGetVersion{}).Call(s.Browser); err == nil {
+		return nil
+	}
+	log.Warnf("Browser is not responding, connecting again")
+	s.stop()
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		if err = s.launch(); err == nil {
+			return nil
+		}
+		log.Warnf("Browser connection attempt %d failed : %v", attempt, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	return err
+}
+
+// release gives the tab of the last scrape back to the pool
+func (s *RodScraper) release(healthy bool) {
+	if s.current != nil {
+		s.pool.put(s.current, healthy)
+		s.current = nil
+	}
+}
+
+// Close closes the tabs and the local browser, or disconnects from the
+// remote browser, which keeps running
+func (s *RodScraper) Close() error {
+	if s.Browser == nil {
+		return nil
+	}
+	s.release(false)
+	s.stop()
+	return nil
 }
 
 func (s *RodScraper) Scrape(paramURL string) (*ScrapedData, error) {
@@ -61,16 +218,25 @@ func (s *RodScraper) Scrape(paramURL string) (*ScrapedData, error) {
 	if err != nil {
 		return scraped, err
 	}
-	if s.depth > 0 {
-		if err := s.checkRobots(parsedURL); err != nil {
-			return scraped, err
-		}
+	if err := s.Robots.Allowed(parsedURL, s.depth, s.UserAgent); err != nil {
+		return scraped, err
 	}
 
+	// The tab of the previous page was kept for EvalJS
+	s.release(true)
+	if err := s.ensureBrowser(); err != nil {
+		return scraped, err
+	}
+	page, err := s.pool.get()
+	if err != nil {
+		return scraped, err
+	}
+	s.current = page
+	s.Page = page.page
+	page.network.reset()
+
 	var e proto.NetworkResponseReceived
-	s.Page = s.Browser.MustPage("")
 	wait := s.Page.WaitEvent(&e)
-	go s.Page.MustHandleDialog()
 
 	errRod := rod.Try(func() {
 		s.Page.
@@ -80,21 +246,27 @@ func (s *RodScraper) Scrape(paramURL string) (*ScrapedData, error) {
 	})
 	if errRod != nil {
 		log.Errorf("Error while visiting %s : %s", paramURL, errRod.Error())
+		s.release(false)
+		s.Page = nil
 		return scraped, errRod
 	}
 
 	wait()
-	if e.Response.SecurityDetails != nil && len(e.Response.SecurityDetails.Issuer) > 0 {
-		scraped.CertIssuer = append(scraped.CertIssuer, e.Response.SecurityDetails.Issuer)
+	if e.Response.SecurityDetails != nil {
+		appendCertIssuer(scraped, e.Response.SecurityDetails.Issuer)
 	}
-	scraped.URLs = ScrapedURL{e.Response.URL, e.Response.Status}
-	scraped.Headers = make(map[string][]string)
+	headers := make(map[string][]string)
 	for header, value := range e.Response.Headers {
-		lowerCaseKey := strings.ToLower(header)
-		scraped.Headers[lowerCaseKey] = append(scraped.Headers[lowerCaseKey], value.String())
+		headers[header] = append(headers[header], value.String())
+	}
+	extractResponse(scraped, e.Response.URL, e.Response.Status, headers)
+	if e.Response.SecurityDetails != nil {
+		scraped.URLs.TLS = s.extractTLS(e.Response)
 	}
 
-	scraped.DNS = scrapeDNS(paramURL)
+	if s.Resolver != nil {
+		scraped.DNS = scrapeDNS(s.Resolver, paramURL)
+	}
 
 	//TODO : headers and cookies could be parsed before load completed
 	errRod = rod.Try(func() {
@@ -104,36 +276,19 @@ func (s *RodScraper) Scrape(paramURL string) (*ScrapedData, error) {
 	})
 	if errRod != nil {
 		log.Errorf("Error while loading %s : %s", paramURL, errRod.Error())
+		s.release(false)
+		s.Page = nil
 		return scraped, errRod
 	}
 
-	scraped.HTML = s.Page.MustHTML()
-
-	scripts, _ := s.Page.Elements("script")
-	for _, script := range scripts {
-		if src, _ := script.Property("src"); src.Val() != nil {
-			scraped.Scripts = append(scraped.Scripts, src.String())
-		}
+	inline := extractHTML(scraped, s.Page.MustHTML())
+	page.network.record(scraped)
+	if s.ScriptLoader != nil {
+		s.ScriptLoader.Load(scraped, inline)
 	}
 
-	metas, _ := s.Page.Elements("meta")
-	scraped.Meta = make(map[string][]string)
-	for _, meta := range metas {
-		name, _ := meta.Attribute("name")
-		if name == nil {
-			name, _ = meta.Attribute("property")
-		}
-		if name != nil {
-			if content, _ := meta.Attribute("content"); content != nil {
-				nameLower := strings.ToLower(*name)
-				scraped.Meta[nameLower] = append(scraped.Meta[nameLower], *content)
-			}
-		}
-	}
-
-	scraped.Cookies = make(map[string]string)
-	str := []string{}
-	cookies, _ := s.Page.Cookies(str)
+	// The cookie jar also has the cookies set by scripts
+	cookies, _ := s.Page.Cookies(nil)
 	for _, cookie := range cookies {
 		scraped.Cookies[cookie.Name] = cookie.Value
 	}
@@ -141,55 +296,71 @@ func (s *RodScraper) Scrape(paramURL string) (*ScrapedData, error) {
 	return scraped, nil
 }
 
-func (s *RodScraper) EvalJS(jsProp string) (*string, error) {
-	res, err := s.Page.Eval(jsProp)
-	if err == nil && res != nil && res.Value.Val() != nil {
-		value := ""
-		if res.Type == "string" || res.Type == "number" {
-			value = res.Value.String()
+// extractTLS returns the TLS details of the response to the page. The chain
+// is asked to the browser, only the leaf given with the response is known
+// when it fails.
+func (s *RodScraper) extractTLS(response *proto.NetworkResponse) *ScrapedTLS {
+	details := response.SecurityDetails
+	scrapedTLS := &ScrapedTLS{
+		Version:     details.Protocol,
+		CipherSuite: ianaCipherSuite(details.KeyExchange, details.Cipher, details.Mac),
+		ALPN:        response.Protocol,
+	}
+	if u, err := url.Parse(response.URL); err == nil {
+		origin := u.Scheme + "://" + u.Host
+		if chain, err := (proto.NetworkGetCertificate{Origin: origin}).Call(s.Page); err == nil {
+			for _, cert := range parseCertificates(chain.TableNames) {
+				scrapedTLS.Certificates = append(scrapedTLS.Certificates, extractCertificate(cert))
+			}
 		}
-		return &value, err
-	} else {
-		return nil, err
 	}
+	if len(scrapedTLS.Certificates) == 0 {
+		scrapedTLS.Certificates = []ScrapedCertificate{{
+			Subject:   "CN=" + details.SubjectName,
+			Issuer:    "CN=" + details.Issuer,
+			SANs:      details.SanList,
+			NotBefore: details.ValidFrom.Time().UTC(),
+			NotAfter:  details.ValidTo.Time().UTC(),
+		}}
+	}
+	return scrapedTLS
 }
 
-// checkRobots function implements the robots.txt file checking for rod scraper
-// Borrowed from Colly : https://github.com/gocolly/colly/blob/e664321b4e5b94ed568999d37a7cbdef81d61bda/colly.go#L777
-// Return nil if no robot.txt or cannot be parsed
-func (s *RodScraper) checkRobots(u *url.URL) error {
-	s.lock.RLock()
-	robot, ok := s.robotsMap[u.Host]
-	s.lock.RUnlock()
+// EvalJS returns the value of the JS property path jsProp, which is not
+// evaluated as an expression
+func (s *RodScraper) EvalJS(jsProp string) (*string, error) {
+	if _, err := ParseJSPath(jsProp); err != nil {
+		return nil, err
+	}
+	values, err := s.EvalJSProperties([]string{jsProp})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[jsProp]
 	if !ok {
-		// no robots file cached
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client := &http.Client{Transport: tr}
-		resp, err := client.Get(u.Scheme + "://" + u.Host + "/robots.txt")
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-
-		robot, err = robotstxt.FromResponse(resp)
-		if err != nil {
-			return err
-		}
-		s.lock.Lock()
-		s.robotsMap[u.Host] = robot
-		s.lock.Unlock()
+		return nil, errors.New("UndefinedProperty")
 	}
+	return &value.Value, nil
+}
 
-	uaGroup := robot.FindGroup(s.UserAgent)
-
-	eu := u.EscapedPath()
-	if u.RawQuery != "" {
-		eu += "?" + u.Query().Encode()
+// EvalJSProperties returns the defined JS properties of jsProps, all of
+// them read in a single call to the browser. Invalid paths are ignored.
+func (s *RodScraper) EvalJSProperties(jsProps []string) (map[string]JSValue, error) {
+	if s.Page == nil {
+		return nil, errors.New("NoPageScraped")
+	}
+	res, err := s.Page.Eval(jsPropertiesScript, jsPropertiesArgs(jsProps))
+	if err != nil {
+		return nil, err
 	}
-	if !uaGroup.Test(eu) {
-		return errors.New("ErrRobotsTxtBlocked")
+	values := make(map[string]JSValue)
+	for prop, value := range res.Value.Map() {
+		values[prop] = JSValue{Type: value.Get("type").Str(), Value: value.Get("value").Str()}
 	}
-	return nil
+	return values, nil
+}
+
+// CrawlDelay returns the robots.txt Crawl-delay of the host of u
+func (s *RodScraper) CrawlDelay(u *url.URL) time.Duration {
+	return s.Robots.CrawlDelay(u, s.UserAgent)
 }
@@ -0,0 +1,154 @@
+package scraper
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// networkLog records the requests sent by a tab during a scrape, blocked or
+// not, as evidence for the scripts and xhr patterns, and the responses
+// received
+type networkLog struct {
+	lock      sync.Mutex
+	scripts   map[string]struct{}
+	xhr       map[string]struct{}
+	resources []ScrapedResource
+}
+
+func newNetworkLog() *networkLog {
+	l := &networkLog{}
+	l.reset()
+	return l
+}
+
+// reset forgets the requests and responses of the previous scrape
+func (l *networkLog) reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.scripts = make(map[string]struct{})
+	l.xhr = make(map[string]struct{})
+	l.resources = nil
+}
+
+func (l *networkLog) request(resourceType proto.NetworkResourceType, rawURL string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	switch resourceType {
+	case proto.NetworkResourceTypeScript:
+		l.scripts[rawURL] = struct{}{}
+	case proto.NetworkResourceTypeXHR, proto.NetworkResourceTypeFetch:
+		if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+			l.xhr[strings.ToLower(u.Hostname())] = struct{}{}
+		}
+	}
+}
+
+func (l *networkLog) response(response *proto.NetworkResponse) {
+	if strings.HasPrefix(response.URL, "data:") {
+		return
+	}
+	resource := ScrapedResource{
+		URL:      response.URL,
+		Status:   response.Status,
+		Headers:  make(map[string][]string),
+		MimeType: response.MIMEType,
+		RemoteIP: response.RemoteIPAddress,
+		Protocol: response.Protocol,
+	}
+	for header, value := range response.Headers {
+		lowerCaseKey := strings.ToLower(header)
+		// Headers received several times, such as set-cookie, are joined by new lines
+		resource.Headers[lowerCaseKey] = append(resource.Headers[lowerCaseKey], strings.Split(value.String(), "\n")...)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.resources = append(l.resources, resource)
+}
+
+// record adds the script URLs and XHR hosts requested, and the responses
+// received, to scraped
+func (l *networkLog) record(scraped *ScrapedData) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	known := make(map[string]struct{}, len(scraped.Scripts))
+	for _, script := range scraped.Scripts {
+		known[script] = struct{}{}
+	}
+	for _, script := range sortedKeys(l.scripts) {
+		if _, ok := known[script]; !ok {
+			scraped.Scripts = append(scraped.Scripts, script)
+		}
+	}
+	scraped.XHR = sortedKeys(l.xhr)
+	scraped.Resources = append([]ScrapedResource(nil), l.resources...)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// blocked tells whether a request of resourceType to u must not be sent.
+// Documents are never blocked, the page itself could not load otherwise.
+func (s *RodScraper) blocked(resourceType proto.NetworkResourceType, u *url.URL) bool {
+	if resourceType == proto.NetworkResourceTypeDocument {
+		return false
+	}
+	for _, blockedType := range s.BlockedResourceTypes {
+		if strings.EqualFold(blockedType, string(resourceType)) {
+			return true
+		}
+	}
+	if u == nil {
+		return false
+	}
+	hostname := strings.ToLower(u.Hostname())
+	for _, domain := range s.BlockedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupPage records the requests and responses of a new tab, and intercepts
+// the requests to block the unwanted resource types and domains
+func (s *RodScraper) setupPage(pooled *pooledPage) error {
+	pooled.network = newNetworkLog()
+	go pooled.page.EachEvent(func(e *proto.NetworkRequestWillBeSent) {
+		pooled.network.request(e.Type, e.Request.URL)
+	}, func(e *proto.NetworkResponseReceived) {
+		pooled.network.response(e.Response)
+	})()
+
+	if len(s.BlockedResourceTypes) == 0 && len(s.BlockedDomains) == 0 {
+		return nil
+	}
+	router := pooled.page.HijackRequests()
+	err := router.Add("*", "", func(h *rod.Hijack) {
+		if s.blocked(h.Request.Type(), h.Request.URL()) {
+			pooled.network.request(h.Request.Type(), h.Request.URL().String())
+			h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+			return
+		}
+		h.ContinueRequest(&proto.FetchContinueRequest{})
+	})
+	if err != nil {
+		return err
+	}
+	go router.Run()
+	return nil
+}
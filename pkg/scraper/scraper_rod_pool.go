@@ -0,0 +1,170 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const pageCloseTimeout = 5 * time.Second
+
+// pagePool keeps browser tabs open between scrapes. A tab is closed rather
+// than reused once older than maxAge or used maxUses times (0 means no
+// limit), when it failed, or when maxIdle tabs are already waiting.
+// With incognito, each tab gets its own browser context, so that cookies
+// and storage are not shared between tabs. setup, when set, prepares each
+// new tab.
+type pagePool struct {
+	browser   *rod.Browser
+	incognito bool
+	maxIdle   int
+	maxAge    time.Duration
+	maxUses   int
+	setup     func(page *pooledPage) error
+	lock      sync.Mutex
+	idle      []*pooledPage
+	open      int
+}
+
+type pooledPage struct {
+	// page is canceled when the tab is closed, base never is
+	page    *rod.Page
+	base    *rod.Page
+	cancel  context.CancelFunc
+	context *rod.Browser
+	created time.Time
+	uses    int
+	network *networkLog
+}
+
+func newPagePool(browser *rod.Browser, incognito bool, maxIdle int, maxAge time.Duration, maxUses int) *pagePool {
+	if maxIdle < 1 {
+		maxIdle = 1
+	}
+	return &pagePool{browser: browser, incognito: incognito, maxIdle: maxIdle, maxAge: maxAge, maxUses: maxUses}
+}
+
+func (p *pagePool) expired(page *pooledPage) bool {
+	return (p.maxAge > 0 && time.Since(page.created) > p.maxAge) || (p.maxUses > 0 && page.uses >= p.maxUses)
+}
+
+// get returns an idle tab, or opens a new one
+func (p *pagePool) get() (*pooledPage, error) {
+	p.lock.Lock()
+	for len(p.idle) > 0 {
+		page := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if !p.expired(page) {
+			page.uses++
+			p.lock.Unlock()
+			return page, nil
+		}
+		p.lock.Unlock()
+		p.discard(page)
+		p.lock.Lock()
+	}
+	p.lock.Unlock()
+	return p.openPage()
+}
+
+func (p *pagePool) openPage() (*pooledPage, error) {
+	pooled := &pooledPage{created: time.Now(), uses: 1}
+	browser := p.browser
+	if p.incognito {
+		incognito, err := p.browser.Incognito()
+		if err != nil {
+			return nil, err
+		}
+		pooled.context = incognito
+		browser = incognito
+	}
+	page, err := browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		if pooled.context != nil {
+			_ = pooled.context.Close()
+		}
+		return nil, err
+	}
+	pooled.base = page
+	pooled.page, pooled.cancel = page.WithCancel()
+	go acceptDialogs(pooled.page)
+
+	p.lock.Lock()
+	p.open++
+	p.lock.Unlock()
+	if p.setup != nil {
+		if err := p.setup(pooled); err != nil {
+			p.discard(pooled)
+			return nil, err
+		}
+	}
+	return pooled, nil
+}
+
+// put gives page back once scraped. healthy is false when the scrape failed,
+// the tab is then closed as it may have crashed.
+func (p *pagePool) put(page *pooledPage, healthy bool) {
+	if healthy && !p.expired(page) {
+		// Leave the scraped site so that its scripts stop running
+		healthy = page.base.Timeout(pageCloseTimeout).Navigate("about:blank") == nil
+	}
+	p.lock.Lock()
+	if healthy && !p.expired(page) && len(p.idle) < p.maxIdle {
+		p.idle = append(p.idle, page)
+		p.lock.Unlock()
+		return
+	}
+	p.lock.Unlock()
+	p.discard(page)
+}
+
+// discard closes the tab and its browser context
+func (p *pagePool) discard(page *pooledPage) {
+	page.cancel()
+	_ = page.base.Timeout(pageCloseTimeout).Close()
+	if page.context != nil {
+		_ = page.context.Close()
+	}
+	p.lock.Lock()
+	p.open--
+	p.lock.Unlock()
+}
+
+// openPages returns the number of tabs opened by the pool and not closed yet
+func (p *pagePool) openPages() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.open
+}
+
+// close closes the idle tabs
+func (p *pagePool) close() {
+	p.lock.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.lock.Unlock()
+	for _, page := range idle {
+		p.discard(page)
+	}
+}
+
+// acceptDialogs accepts the alerts, confirms and prompts of page until it is closed
+func acceptDialogs(page *rod.Page) {
+	for page.GetContext().Err() == nil {
+		opened := false
+		_ = rod.Try(func() {
+			wait, handle := page.HandleDialog()
+			// Without event, the tab or the browser is gone
+			if dialog := wait(); dialog.Type != "" && page.GetContext().Err() == nil {
+				opened = true
+				_ = handle(&proto.PageHandleJavaScriptDialog{Accept: true})
+			}
+		})
+		if !opened {
+			return
+		}
+	}
+}
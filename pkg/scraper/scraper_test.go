@@ -1,21 +1,124 @@
 package scraper
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDnsScraping(t *testing.T) {
-	scraperTest := &CollyScraper{}
+	resolver := FakeResolver{
+		"example.co.uk": {
+			"NS":  {"ns1.example.net"},
+			"MX":  {"mx.example.net"},
+			"TXT": {"v=spf1 include:_spf.google.com -all", "google-site-verification=abc"},
+			"CAA": {`0 issue "letsencrypt.org"`},
+		},
+		"_dmarc.example.co.uk": {"TXT": {"v=DMARC1; p=none"}},
+		"www.example.co.uk": {
+			"CNAME": {"example.netlify.app"},
+			"SOA":   {"ns1.example.net hostmaster.example.co.uk 1 2 3 4 5"},
+		},
+		"example.netlify.app": {"CNAME": {"lb.netlify.com"}},
+		"lb.netlify.com":      {"A": {"192.0.2.1"}},
+	}
+	dns := scrapeDNS(resolver, "https://www.example.co.uk/page")
+	assert.Equal(t, map[string][]string{
+		"NS":           {"ns1.example.net"},
+		"MX":           {"mx.example.net"},
+		"TXT":          {"v=spf1 include:_spf.google.com -all", "google-site-verification=abc"},
+		"SPF":          {"_spf.google.com"},
+		"VERIFICATION": {"google-site-verification"},
+		"DMARC":        {"v=DMARC1", "p=none"},
+		"CNAME":        {"example.netlify.app", "lb.netlify.com"},
+		"CAA":          {`0 issue "letsencrypt.org"`},
+		"SOA":          {"ns1.example.net hostmaster.example.co.uk 1 2 3 4 5"},
+	}, dns)
+	assert.Empty(t, scrapeDNS(resolver, "http://127.0.0.1:8080/"), "IP addresses have no DNS records")
+	assert.NotPanics(t, func() { scrapeDNS(resolver, "http://intranet/") }, "Single label hosts should be looked up")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+	scraperTest := &CollyScraper{Resolver: FakeResolver{"localhost": {"TXT": {"local"}}}}
 	err := scraperTest.Init()
 	assert.NoError(t, err, "Scraper Init error")
-	res, err := scraperTest.Scrape("https://scrapethissite.com/")
+	res, err := scraperTest.Scrape(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1))
 	assert.NoError(t, err, "Colly scraping error")
-	assert.NotEmpty(t, res.DNS, "There should be some DNS results")
+	assert.Equal(t, map[string][]string{"TXT": {"local"}}, res.DNS, "There should be some DNS results")
+}
+
+// countingResolver counts the lookups of the wrapped resolver
+type countingResolver struct {
+	Resolver
+	lock    sync.Mutex
+	lookups int
+	delay   time.Duration
+}
+
+func (r *countingResolver) Lookup(name string, recordType string) ([]string, error) {
+	r.lock.Lock()
+	r.lookups++
+	r.lock.Unlock()
+	time.Sleep(r.delay)
+	if name == "fail.example.com" {
+		return nil, errors.New("Timeout")
+	}
+	return r.Resolver.Lookup(name, recordType)
+}
+
+func TestCachedResolver(t *testing.T) {
+	counting := &countingResolver{Resolver: FakeResolver{"example.com": {"A": {"192.0.2.1"}}}, delay: 50 * time.Millisecond}
+	resolver := NewCachedResolver(counting, 200*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := resolver.Lookup("Example.com.", "A")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"192.0.2.1"}, values)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, counting.lookups, "Concurrent lookups should be deduplicated")
+
+	values, _ := resolver.Lookup("unknown.example.com", "A")
+	assert.Empty(t, values)
+	resolver.Lookup("unknown.example.com", "A")
+	assert.Equal(t, 2, counting.lookups, "Unknown names should be cached")
+
+	_, err := resolver.Lookup("fail.example.com", "A")
+	assert.Error(t, err)
+	resolver.Lookup("fail.example.com", "A")
+	assert.Equal(t, 4, counting.lookups, "Failed lookups should not be cached")
+
+	time.Sleep(250 * time.Millisecond)
+	resolver.Lookup("example.com", "A")
+	assert.Equal(t, 5, counting.lookups, "Expired records should be looked up again")
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	assert.Len(t, resolver.entries, 1, "Expired records should be removed")
 }
 
 func TestCollyScraper(t *testing.T) {
@@ -42,6 +145,39 @@ func TestCollyScraper(t *testing.T) {
 	if assert.NoError(t, err, "Scrap should work") {
 		assert.NotEmpty(t, res.HTML, "There should be some HTML content")
 	}
+	previous := res
+	res, err = scraperTest.Scrape(ts.URL)
+	if assert.NoError(t, err, "Page should be scraped again") {
+		assert.Equal(t, "testv", res.Cookies["test"])
+		assert.NotSame(t, previous, res)
+	}
+}
+
+func TestCollyScraperConcurrency(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><meta name="generator" content="%s"></head></html>`, r.URL.Path)
+	}))
+	defer ts.Close()
+	scraperTest := &CollyScraper{TimeoutSeconds: 2}
+	if !assert.NoError(t, scraperTest.Init(), "Scraper Init error") {
+		return
+	}
+	assert.True(t, scraperTest.Concurrent(), "Colly scrapes should be independent")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			res, err := scraperTest.Scrape(ts.URL + path)
+			if assert.NoError(t, err, "Scrape error") {
+				assert.Equal(t, ts.URL+path, res.URLs.URL)
+				assert.Equal(t, []string{path}, res.Meta["generator"], "Scrapes should not write into each other")
+			}
+		}(fmt.Sprintf("/page%d", i))
+	}
+	wg.Wait()
+	assert.NoError(t, scraperTest.Close())
 }
 
 func TestRodScraper(t *testing.T) {
@@ -98,12 +234,24 @@ func TestRodScraper(t *testing.T) {
 	res, err = scraperTest.Scrape(ts.URL)
 	assert.NoError(t, err, "Colly scraping error")
 	assert.NotEmpty(t, res.HTML, "There should be some HTML content")
-	resJS, err := scraperTest.EvalJS(`"test"`)
-	assert.Equal(t, "test", *resJS, "Test string should eval as test string...")
-	assert.NoError(t, err, "Rod should render JS")
+	resJS, err := scraperTest.EvalJS("location.protocol")
+	if assert.NoError(t, err, "Rod should read JS properties") {
+		assert.Equal(t, "http:", *resJS)
+	}
 	resJS, err = scraperTest.EvalJS("this.should.throw.error")
 	assert.Nil(t, resJS, "Should return nil")
-	assert.Error(t, err, "Rod should throw error on rendering bad JS")
+	assert.Error(t, err, "Undefined property should throw an error")
+	resJS, err = scraperTest.EvalJS(`document.title = "hacked"`)
+	assert.Nil(t, resJS, "Should return nil")
+	assert.Equal(t, ErrInvalidJSPath, err, "Expressions should not be evaluated")
+	values, err := scraperTest.EvalJSProperties([]string{"document.title", "navigator.webdriver", "location", "this.should.be.undefined"})
+	if assert.NoError(t, err, "EvalJSProperties error") {
+		assert.Equal(t, map[string]JSValue{
+			"document.title":      {Type: "string"},
+			"navigator.webdriver": {Type: "boolean", Value: "true"},
+			"location":            {Type: "object"},
+		}, values)
+	}
 
 	url = "https://twitter.github.io/"
 	err = scraperTest.Init()
@@ -189,6 +337,190 @@ func TestRobot(t *testing.T) {
 
 }
 
+// fakeScraper counts scrapes and evaluates JS properties from a map
+type fakeScraper struct {
+	inits   int
+	scrapes int
+	batches int
+	js      map[string]string
+	// pages are the JS properties by URL, read from the last scraped page
+	// as a browser tab does
+	pages map[string]map[string]string
+	last  string
+}
+
+func (s *fakeScraper) Init() error         { s.inits++; return nil }
+func (s *fakeScraper) CanRenderPage() bool { return true }
+func (s *fakeScraper) SetDepth(depth int)  {}
+func (s *fakeScraper) Close() error        { return nil }
+func (s *fakeScraper) Scrape(paramURL string) (*ScrapedData, error) {
+	s.scrapes++
+	s.last = paramURL
+	return &ScrapedData{URLs: ScrapedURL{URL: paramURL, Status: 200}, HTML: fmt.Sprintf("scrape %d", s.scrapes)}, nil
+}
+func (s *fakeScraper) EvalJS(jsProp string) (*string, error) {
+	if value, ok := s.js[jsProp]; ok {
+		return &value, nil
+	}
+	return nil, errors.New("UndefinedProperty")
+}
+func (s *fakeScraper) EvalJSProperties(jsProps []string) (map[string]JSValue, error) {
+	js := s.js
+	if s.pages != nil {
+		if s.last == "" {
+			return nil, errors.New("NoPageScraped")
+		}
+		js = s.pages[s.last]
+	}
+	s.batches++
+	values := make(map[string]JSValue)
+	for _, jsProp := range jsProps {
+		if value, ok := js[jsProp]; ok {
+			values[jsProp] = JSValue{Type: "string", Value: value}
+		}
+	}
+	return values, nil
+}
+
+func TestParseJSPath(t *testing.T) {
+	valid := map[string][]string{
+		"jQuery.fn.jquery": {"jQuery", "fn", "jquery"},
+		"s_c_il.0._c":      {"s_c_il", "0", "_c"},
+		"SQUARESPACE_ROLLUPS.squarespace-commerce": {"SQUARESPACE_ROLLUPS", "squarespace-commerce"},
+		`__APP__["config"][0]['app.version']`:      {"__APP__", "config", "0", "app.version"},
+	}
+	for path, keys := range valid {
+		parsed, err := ParseJSPath(path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, keys, parsed, path)
+		}
+	}
+	for _, path := range []string{"", "ScrollReveal().version", `"test"`, "a.", "a..b", "[0]", "a[b]", "a[-1]", `a["b]`, `a["b\"]`, "a b", "a;alert(1)"} {
+		_, err := ParseJSPath(path)
+		assert.Equal(t, ErrInvalidJSPath, err, path)
+	}
+	args := jsPropertiesArgs([]string{"a.b", "alert(1)"})
+	assert.Equal(t, [][]interface{}{{"a.b", []string{"a", "b"}}}, args, "Invalid paths should be ignored")
+}
+
+func TestCachedScraper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-cache")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewCachedScraper(&fakeScraper{}, dir, 0, "unknown")
+	assert.Error(t, err, "Unknown mode should throw an error")
+
+	fake := &fakeScraper{js: map[string]string{"jQuery.fn.jquery": "3.6.0"}}
+	cached, err := NewCachedScraper(fake, dir, time.Hour, CacheReadWrite)
+	if assert.NoError(t, err, "Cache creation error") && assert.NoError(t, cached.Init(), "Cache Init error") {
+		res, err := cached.Scrape("https://example.com")
+		assert.NoError(t, err, "Scrape error")
+		assert.Equal(t, "scrape 1", res.HTML)
+		value, err := cached.EvalJS("jQuery.fn.jquery")
+		if assert.NoError(t, err, "EvalJS error") {
+			assert.Equal(t, "3.6.0", *value)
+		}
+		_, err = cached.EvalJS("React.version")
+		assert.Error(t, err, "Undefined property should throw an error")
+		values, err := cached.EvalJSProperties([]string{"jQuery.fn.jquery", "React.version"})
+		if assert.NoError(t, err, "EvalJSProperties error") {
+			assert.Equal(t, map[string]JSValue{"jQuery.fn.jquery": {Type: "string", Value: "3.6.0"}}, values)
+			assert.Equal(t, 2, fake.batches, "Cached and undefined properties should not be evaluated again")
+		}
+
+		res, err = cached.Scrape("https://example.com")
+		assert.NoError(t, err, "Scrape error")
+		assert.Equal(t, "scrape 1", res.HTML, "Fresh page should be served from cache")
+		assert.Equal(t, 1, fake.scrapes)
+	}
+
+	cached.Mode = CacheRecord
+	res, err := cached.Scrape("https://example.com")
+	assert.NoError(t, err, "Scrape error")
+	assert.Equal(t, "scrape 2", res.HTML, "Record mode should always scrape")
+
+	cached.Mode = CacheReadWrite
+	cached.TTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	res, err = cached.Scrape("https://example.com")
+	assert.NoError(t, err, "Scrape error")
+	assert.Equal(t, "scrape 3", res.HTML, "Expired page should be scraped again")
+	_, err = cached.EvalJS("jQuery.fn.jquery")
+	assert.NoError(t, err, "EvalJS error")
+
+	replay, err := NewCachedScraper(&fakeScraper{}, dir, time.Nanosecond, CacheReplay)
+	if assert.NoError(t, err, "Cache creation error") && assert.NoError(t, replay.Init(), "Cache Init error") {
+		res, err := replay.Scrape("https://example.com")
+		if assert.NoError(t, err, "Replay should ignore TTL") {
+			assert.Equal(t, "scrape 3", res.HTML)
+			assert.True(t, replay.CanRenderPage(), "Replay should keep the recorded scraper capabilities")
+		}
+		value, err := replay.EvalJS("jQuery.fn.jquery")
+		if assert.NoError(t, err, "JS should be replayed") {
+			assert.Equal(t, "3.6.0", *value)
+		}
+		_, err = replay.EvalJS("React.version")
+		assert.Error(t, err, "Undefined property should stay undefined")
+		values, err := replay.EvalJSProperties([]string{"jQuery.fn.jquery", "React.version"})
+		if assert.NoError(t, err, "JS should be replayed") {
+			assert.Equal(t, map[string]JSValue{"jQuery.fn.jquery": {Type: "string", Value: "3.6.0"}}, values)
+		}
+		_, err = replay.Scrape("https://example.com/notcached")
+		assert.Equal(t, ErrCacheMiss, err, "Replay should not scrape")
+	}
+}
+
+func TestCachedScraperJS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-cache")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	pages := map[string]map[string]string{
+		"https://a.example.com": {"A.version": "1.0"},
+		"https://b.example.com": {"B.version": "2.0"},
+	}
+	props := []string{"A.version", "B.version"}
+
+	fake := &fakeScraper{pages: pages}
+	cached, err := NewCachedScraper(fake, dir, 0, CacheReadWrite)
+	if !assert.NoError(t, err, "Cache creation error") || !assert.NoError(t, cached.Init(), "Cache Init error") {
+		return
+	}
+	for _, paramURL := range []string{"https://a.example.com", "https://b.example.com"} {
+		_, err = cached.Scrape(paramURL)
+		assert.NoError(t, err, "Scrape error")
+		_, err = cached.EvalJSProperties(props)
+		assert.NoError(t, err, "EvalJSProperties error")
+	}
+	assert.Equal(t, 2, fake.batches)
+
+	// The fake scraper is still on b, a is served from the cache
+	_, err = cached.Scrape("https://a.example.com")
+	assert.NoError(t, err, "Scrape error")
+	values, err := cached.EvalJSProperties(append(props, "C.version"))
+	if assert.NoError(t, err, "EvalJSProperties error") {
+		assert.Equal(t, map[string]JSValue{"A.version": {Type: "string", Value: "1.0"}}, values, "JS of another page should not leak")
+	}
+	assert.Equal(t, 2, fake.batches, "Cached pages should not be evaluated by the wrapped scraper")
+
+	// No page was scraped by this one
+	fresh := &fakeScraper{pages: pages}
+	cached, err = NewCachedScraper(fresh, dir, 0, CacheReadWrite)
+	if assert.NoError(t, err, "Cache creation error") && assert.NoError(t, cached.Init(), "Cache Init error") {
+		_, err = cached.Scrape("https://b.example.com")
+		assert.NoError(t, err, "Scrape error")
+		values, err = cached.EvalJSProperties(props)
+		if assert.NoError(t, err, "Cached values should be returned") {
+			assert.Equal(t, map[string]JSValue{"B.version": {Type: "string", Value: "2.0"}}, values)
+		}
+		assert.Equal(t, 0, fresh.scrapes+fresh.batches)
+	}
+}
+
 func MockHTTP(content string) *httptest.Server {
 	ts := httptest.NewServer(
 		http.HandlerFunc(
@@ -197,3 +529,636 @@ func MockHTTP(content string) *httptest.Server {
 			}))
 	return ts
 }
+
+func TestSitemapURLs(t *testing.T) {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+	robotsFetches := 0
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsFetches++
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nSitemap: %s/sitemap_index.xml\n", ts.URL)
+	})
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>%s/posts.xml.gz</loc></sitemap>
+<sitemap><loc>%s/missing.xml</loc></sitemap>
+</sitemapindex>`, ts.URL, ts.URL)
+	})
+	mux.HandleFunc("/posts.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%s/posts/1</loc></url>
+<url><loc> %s/posts/2 </loc></url>
+<url><loc>https://cdn.example.com/posts/3</loc></url>
+</urlset>`, ts.URL, ts.URL)
+		gz.Close()
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%s/posts/1</loc></url>
+<url><loc>%s/about</loc></url>
+<url><loc>%s/contact</loc></url>
+</urlset>`, ts.URL, ts.URL, ts.URL)
+	})
+	ts = httptest.NewServer(mux)
+	defer ts.Close()
+
+	fetcher := NewFetcher(2, "gowap-test", false)
+	robots, _ := NewRobotsPolicy(RobotsIgnore, 0, fetcher)
+	assert.Equal(t, []string{ts.URL + "/posts/1", ts.URL + "/about", ts.URL + "/contact", ts.URL + "/posts/2"}, fetcher.SitemapURLs(ts.URL+"/some/page", robots, 10), "Sitemap pages of the same host should be returned once")
+	assert.Equal(t, []string{ts.URL + "/posts/1", ts.URL + "/about"}, fetcher.SitemapURLs(ts.URL, robots, 2), "Sitemap pages should be limited")
+	assert.Equal(t, 1, robotsFetches, "robots.txt should be read from the policy cache")
+	assert.Equal(t, []string{ts.URL + "/posts/1", ts.URL + "/about", ts.URL + "/contact"}, fetcher.SitemapURLs(ts.URL, nil, 10), "Only /sitemap.xml should be read without a policy")
+
+	_, err := fetcher.Fetch(ts.URL+"/sitemap.xml", 10)
+	assert.Error(t, err, "Resources bigger than the limit should be refused")
+}
+
+func TestFetcherCertificates(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /admin\n")
+	}))
+	defer ts.Close()
+
+	_, err := NewFetcher(2, "GoWap", false).Fetch(ts.URL+"/robots.txt", 1024)
+	assert.Error(t, err, "Invalid certificates should be refused by default")
+	resource, err := NewFetcher(2, "GoWap", true).Fetch(ts.URL+"/robots.txt", 1024)
+	if assert.NoError(t, err, "Invalid certificates should be accepted when not verified") {
+		assert.Equal(t, 200, resource.Status)
+	}
+}
+
+func TestRobotsPolicy(t *testing.T) {
+	robotsFetches := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsFetches++
+		fmt.Fprint(w, "User-agent: GoWap\nDisallow: /private\nCrawl-delay: 2\n\nUser-agent: *\nDisallow: /admin\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	private, _ := url.Parse(ts.URL + "/private")
+	admin, _ := url.Parse(ts.URL + "/admin")
+
+	_, err := NewRobotsPolicy("sometimes", 0, NewFetcher(2, "GoWap", false))
+	assert.Error(t, err, "Unknown modes should be refused")
+
+	ignore, _ := NewRobotsPolicy(RobotsIgnore, 0, NewFetcher(2, "GoWap", false))
+	assert.NoError(t, ignore.Allowed(private, 1, "GoWap"), "Ignore mode should allow every page")
+	assert.Zero(t, ignore.CrawlDelay(private, "GoWap"), "Ignore mode should not delay")
+	assert.Zero(t, robotsFetches, "Ignore mode should not fetch robots.txt")
+
+	crawled, _ := NewRobotsPolicy(RobotsCrawled, 0, NewFetcher(2, "GoWap", false))
+	assert.NoError(t, crawled.Allowed(private, 0, "GoWap"), "The analyzed url should be allowed")
+	assert.Equal(t, ErrRobotsTxtBlocked, crawled.Allowed(private, 1, "GoWap"), "Crawled pages should be checked")
+	assert.NoError(t, crawled.Allowed(admin, 1, "GoWap"), "Only the group of the user agent applies")
+	assert.Error(t, crawled.Allowed(admin, 1, "Other"), "Other user agents use the * group")
+	assert.Equal(t, 2*time.Second, crawled.CrawlDelay(private, "GoWap"), "Crawl-delay should be read")
+	assert.Zero(t, crawled.CrawlDelay(private, "Other"))
+	assert.Equal(t, 1, robotsFetches, "robots.txt should be cached")
+
+	always, _ := NewRobotsPolicy(RobotsAlways, 50*time.Millisecond, NewFetcher(2, "GoWap", false))
+	assert.Error(t, always.Allowed(private, 0, "GoWap"), "The analyzed url should be checked too")
+	time.Sleep(60 * time.Millisecond)
+	assert.Error(t, always.Allowed(private, 0, "GoWap"))
+	assert.Equal(t, 3, robotsFetches, "robots.txt should be fetched again once expired")
+
+	collyScraperTest := &CollyScraper{UserAgent: "GoWap", TimeoutSeconds: 2, Robots: always}
+	if assert.NoError(t, collyScraperTest.Init(), "Scraper Init error") {
+		_, err = collyScraperTest.Scrape(ts.URL + "/private")
+		assert.Equal(t, ErrRobotsTxtBlocked, err, "Colly should use the shared policy")
+		_, err = collyScraperTest.Scrape(ts.URL + "/public")
+		assert.NoError(t, err)
+		assert.Equal(t, 2*time.Second, collyScraperTest.CrawlDelay(private))
+	}
+}
+
+func TestRobotsPolicyLargeAndFailing(t *testing.T) {
+	robotsFetches := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsFetches++
+		if strings.HasPrefix(r.Host, "localhost:") {
+			panic(http.ErrAbortHandler)
+		}
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		for i := 0; i < maxRobotsSize/20; i++ {
+			fmt.Fprintf(w, "Disallow: /p%08d\n", i)
+		}
+		fmt.Fprint(w, "Disallow: /public\n")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	policy, _ := NewRobotsPolicy(RobotsAlways, 0, NewFetcher(2, "GoWap", false))
+	private, _ := url.Parse(ts.URL + "/private")
+	public, _ := url.Parse(ts.URL + "/public")
+	assert.Equal(t, ErrRobotsTxtBlocked, policy.Allowed(private, 1, "GoWap"), "The beginning of a large robots.txt should be read")
+	assert.NoError(t, policy.Allowed(public, 1, "GoWap"), "The rules after the size limit should be ignored")
+
+	failing, _ := url.Parse(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1) + "/page")
+	assert.Error(t, policy.Allowed(failing, 1, "GoWap"))
+	assert.Error(t, policy.Allowed(failing, 1, "GoWap"))
+	assert.Equal(t, 2, robotsFetches, "Failures should be cached")
+}
+
+func TestRodPagePool(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/alert" {
+			fmt.Fprint(w, `<html><body><script>alert("blocking")</script></body></html>`)
+			return
+		}
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	scraperTest := &RodScraper{TimeoutSeconds: 5, LoadingTimeoutSeconds: 5, UserAgent: "GoWap", PoolSize: 2, PageMaxUses: 50}
+	if !assert.NoError(t, scraperTest.Init(), "Scraper Init error") {
+		return
+	}
+	defer scraperTest.Close()
+	targets := func() int {
+		pages, err := scraperTest.Browser.Pages()
+		assert.NoError(t, err)
+		return len(pages)
+	}
+	initialTargets := targets()
+
+	for i := 0; i < 300; i++ {
+		_, err := scraperTest.Scrape(fmt.Sprintf("%s/page%d", ts.URL, i))
+		assert.NoError(t, err, "Scrape error")
+		if i%50 == 0 {
+			assert.LessOrEqual(t, targets(), initialTargets+2, "Open tabs should not grow")
+		}
+	}
+	assert.LessOrEqual(t, scraperTest.pool.openPages(), 2, "Tabs should be reused")
+	title, err := scraperTest.EvalJS("document.title")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/page299", *title, "JS should be evaluated on the last scraped page")
+	}
+
+	_, err = scraperTest.Scrape(ts.URL + "/alert")
+	assert.NoError(t, err, "Dialogs should not block the page")
+
+	// The browser is launched again after a crash
+	scraperTest.launcher.Kill()
+	_, err = scraperTest.Scrape(ts.URL + "/after-crash")
+	assert.NoError(t, err, "Browser should be launched again")
+	title, err = scraperTest.EvalJS("document.title")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/after-crash", *title)
+	}
+
+	assert.NoError(t, scraperTest.Close(), "Close error")
+	assert.Nil(t, scraperTest.Browser, "Browser should be closed")
+	assert.NoError(t, scraperTest.Close(), "Closing twice should not fail")
+	_, err = scraperTest.Scrape(ts.URL)
+	assert.Error(t, err, "Closed scraper should not scrape")
+}
+
+func TestRodLauncher(t *testing.T) {
+	scraperTest := &RodScraper{
+		BinPath:     "/opt/chrome/chrome",
+		UserDataDir: "/tmp/gowap-profile",
+		Flags:       []string{"--window-size=1920,1080", "disable-gpu", "--proxy-server=http://proxy:3128"},
+	}
+	l := scraperTest.newLauncher()
+	assert.Equal(t, "/opt/chrome/chrome", l.Get(flags.Bin))
+	assert.Equal(t, "/tmp/gowap-profile", l.Get(flags.UserDataDir))
+	assert.True(t, l.Has(flags.Headless), "Browser should be headless by default")
+	assert.Equal(t, "1920,1080", l.Get("window-size"))
+	assert.Equal(t, "http://proxy:3128", l.Get("proxy-server"))
+	assert.True(t, l.Has("disable-gpu"))
+
+	scraperTest.ShowBrowser = true
+	assert.False(t, scraperTest.newLauncher().Has(flags.Headless))
+
+	// Remote browser restarting : its websocket URL is resolved at each connection
+	var wsURL string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json/version" {
+			fmt.Fprintf(w, `{"webSocketDebuggerUrl": "%s"}`, wsURL)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	wsURL = "ws" + strings.TrimPrefix(ts.URL, "http") + "/devtools/browser/1"
+	remote := &RodScraper{ControlURL: ts.URL}
+	assert.Error(t, remote.Init(), "Connection should fail when the browser doesn't answer")
+	assert.Nil(t, remote.Browser)
+	assert.NoError(t, remote.Close(), "Closing a scraper not connected should not fail")
+}
+
+func TestRodBlocking(t *testing.T) {
+	scraperTest := &RodScraper{BlockedResourceTypes: []string{"image", "Font"}, BlockedDomains: []string{"ads.example"}}
+	parse := func(raw string) *url.URL {
+		u, _ := url.Parse(raw)
+		return u
+	}
+	assert.True(t, scraperTest.blocked(proto.NetworkResourceTypeImage, parse("https://example.com/logo.png")))
+	assert.True(t, scraperTest.blocked(proto.NetworkResourceTypeScript, parse("https://cdn.ads.example/ad.js")), "Subdomains should be blocked")
+	assert.False(t, scraperTest.blocked(proto.NetworkResourceTypeScript, parse("https://badads.example/ad.js")))
+	assert.False(t, scraperTest.blocked(proto.NetworkResourceTypeDocument, parse("https://ads.example/")), "Documents should never be blocked")
+
+	log := newNetworkLog()
+	log.request(proto.NetworkResourceTypeScript, "https://cdn.example.com/jquery.js")
+	log.request(proto.NetworkResourceTypeScript, "https://example.com/app.js")
+	log.request(proto.NetworkResourceTypeXHR, "https://API2.amplitude.com/2/httpapi")
+	log.request(proto.NetworkResourceTypeFetch, "https://api2.amplitude.com/batch")
+	log.request(proto.NetworkResourceTypeImage, "https://example.com/logo.png")
+	scraped := &ScrapedData{Scripts: []string{"https://example.com/app.js"}}
+	log.record(scraped)
+	assert.Equal(t, []string{"https://example.com/app.js", "https://cdn.example.com/jquery.js"}, scraped.Scripts)
+	assert.Equal(t, []string{"api2.amplitude.com"}, scraped.XHR)
+	log.reset()
+	scraped = &ScrapedData{}
+	log.record(scraped)
+	assert.Empty(t, scraped.XHR, "Requests of the previous scrape should be forgotten")
+
+	// Blocked requests are still recorded
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><img src="/logo.png"><script>fetch("/api")</script></body></html>`)
+		case "/logo.png":
+			t.Error("Blocked image should not be requested")
+		default:
+			fmt.Fprint(w, "{}")
+		}
+	}))
+	defer ts.Close()
+	scraperTest = &RodScraper{TimeoutSeconds: 5, LoadingTimeoutSeconds: 5, BlockedResourceTypes: []string{"Image", "Fetch"}}
+	if !assert.NoError(t, scraperTest.Init(), "Scraper Init error") {
+		return
+	}
+	defer scraperTest.Close()
+	res, err := scraperTest.Scrape(ts.URL)
+	if assert.NoError(t, err, "Scrape error") {
+		assert.Equal(t, []string{"127.0.0.1"}, res.XHR, "Blocked fetch should be recorded")
+		if assert.Len(t, res.Resources, 1, "Only the page should be received") {
+			assert.Equal(t, 200, res.Resources[0].Status)
+			assert.Equal(t, "text/html", res.Resources[0].MimeType)
+			assert.Equal(t, "127.0.0.1", res.Resources[0].RemoteIP)
+		}
+	}
+}
+
+func TestScriptLoader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.js":
+			fmt.Fprint(w, "var a;")
+		case "/big.js":
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	loader := &ScriptLoader{Fetcher: NewFetcher(2, "GoWap", false), MaxCount: 3, MaxBytes: 50}
+	scraped := &ScrapedData{
+		URLs:    ScrapedURL{URL: ts.URL + "/page"},
+		Scripts: []string{"", "a.js", ts.URL + "/a.js", "/big.js", "/missing.js", "/ignored.js"},
+	}
+	loader.Load(scraped, []string{"  ", "window.x = 1;"})
+	assert.Equal(t, []ScrapedScript{
+		{Content: "window.x = 1;"},
+		{URL: ts.URL + "/a.js", Content: "var a;"},
+	}, scraped.ScriptContents, "Too large, missing and duplicated scripts should be skipped")
+}
+
+// conformanceFixture serves the pages every scraper must extract the same way
+func conformanceFixture() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/", Expires: time.Now().Add(time.Hour), HttpOnly: true})
+		http.SetCookie(w, &http.Cookie{Name: "lang", Value: "en"})
+		w.Header().Set("X-Powered-By", "Fixture/1.0")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<meta name="Generator" content="TiddlyWiki">
+			<meta property="og:site_name" content="Fixture">
+			<meta http-equiv="X-UA-Compatible" content="IE=edge">
+			<meta charset="utf-8">
+			<script src="/static/jquery-3.5.1.min.js"></script>
+			<script src="https://cdn.example.com/react.js" async></script>
+			<script>var inline = 1;</script>
+		</head><body><div></div></body></html>`)
+	})
+	mux.HandleFunc("/base", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><base href="/assets/"><script src="app.js"></script></head><body></body></html>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/base", http.StatusFound)
+	})
+	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/assets/", func(w http.ResponseWriter, r *http.Request) {})
+	return httptest.NewServer(mux)
+}
+
+// conformanceView keeps the ScrapedData fields every scraper fills the same way
+func conformanceView(scraped *ScrapedData) ScrapedData {
+	return ScrapedData{
+		URLs:    scraped.URLs,
+		Headers: map[string][]string{"x-powered-by": scraped.Headers["x-powered-by"]},
+		Scripts: scraped.Scripts,
+		Cookies: scraped.Cookies,
+		Meta:    scraped.Meta,
+	}
+}
+
+func TestScraperConformance(t *testing.T) {
+	ts := conformanceFixture()
+	defer ts.Close()
+	expected := map[string]ScrapedData{
+		"/": {
+			URLs:    ScrapedURL{URL: ts.URL + "/", Status: 200},
+			Headers: map[string][]string{"x-powered-by": {"Fixture/1.0"}},
+			Scripts: []string{ts.URL + "/static/jquery-3.5.1.min.js", "https://cdn.example.com/react.js"},
+			Cookies: map[string]string{"session": "abc", "lang": "en"},
+			Meta: map[string][]string{
+				"generator":       {"TiddlyWiki"},
+				"og:site_name":    {"Fixture"},
+				"x-ua-compatible": {"IE=edge"},
+			},
+		},
+		"/redirect": {
+			URLs:    ScrapedURL{URL: ts.URL + "/base", Status: 200},
+			Headers: map[string][]string{"x-powered-by": nil},
+			Scripts: []string{ts.URL + "/assets/app.js"},
+			Cookies: map[string]string{},
+			Meta:    map[string][]string{},
+		},
+	}
+
+	scrapers := map[string]Scraper{
+		"colly": &CollyScraper{TimeoutSeconds: 2, LoadingTimeoutSeconds: 2},
+		"rod":   &RodScraper{TimeoutSeconds: 5, LoadingTimeoutSeconds: 5},
+	}
+	for name, scraperTest := range scrapers {
+		t.Run(name, func(t *testing.T) {
+			if !assert.NoError(t, scraperTest.Init(), "Scraper Init error") {
+				return
+			}
+			defer scraperTest.Close()
+			for path, want := range expected {
+				res, err := scraperTest.Scrape(ts.URL + path)
+				if assert.NoError(t, err, "Scrape error") {
+					assert.Equal(t, want, conformanceView(res), "%s should be extracted like the other scrapers", path)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Equal(t, []string{"colly", "hybrid", "rod"}, Names())
+
+	Register("fake", func(options *Options) (Scraper, error) {
+		return &fakeScraper{}, nil
+	})
+	defer func() {
+		registryLock.Lock()
+		delete(registry, "fake")
+		registryLock.Unlock()
+	}()
+	assert.Equal(t, []string{"colly", "fake", "hybrid", "rod"}, Names())
+	s, err := New("fake", &Options{})
+	assert.NoError(t, err)
+	assert.IsType(t, &fakeScraper{}, s)
+	assert.Panics(t, func() {
+		Register("fake", func(options *Options) (Scraper, error) { return nil, nil })
+	})
+
+	_, err = New("unknown", &Options{})
+	assert.EqualError(t, err, "UnknownScraper")
+
+	s, err = New("rod", &Options{TimeoutSeconds: 3, Browser: BrowserOptions{PoolSize: 2, BlockedDomains: []string{"ads.example"}}})
+	assert.NoError(t, err)
+	rod := s.(*RodScraper)
+	assert.Equal(t, 3, rod.TimeoutSeconds)
+	assert.Equal(t, 2, rod.PoolSize)
+	assert.Equal(t, []string{"ads.example"}, rod.BlockedDomains)
+}
+
+func TestHybridScraper(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=static")
+		switch r.URL.Path {
+		case "/empty":
+			fmt.Fprint(w, `<html><body><script src="/app.js"></script></body></html>`)
+		case "/spa":
+			fmt.Fprint(w, `<html><body><div id="root"></div><footer>Loading</footer></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><head><meta name="generator" content="Static"></head><body>Hello</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	browser := &fakeScraper{js: map[string]string{"a.b": "1"}}
+	hybrid := &HybridScraper{Static: &CollyScraper{TimeoutSeconds: 3}, Browser: browser}
+	hybrid.Escalate = func(scraped *ScrapedData) string {
+		if strings.HasSuffix(scraped.URLs.URL, "/lib") {
+			return EscalationTechnologies
+		}
+		return ""
+	}
+	if !assert.NoError(t, hybrid.Init()) {
+		return
+	}
+	defer hybrid.Close()
+
+	scraped, err := hybrid.Scrape(ts.URL + "/")
+	if assert.NoError(t, err) {
+		assert.False(t, hybrid.CanRenderPage())
+		assert.Contains(t, scraped.HTML, "Hello", "Static pages should not be rendered")
+		_, err = hybrid.EvalJSProperties([]string{"a.b"})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 0, browser.scrapes)
+	assert.Equal(t, 0, browser.inits, "The browser should only be launched to render a page")
+	before := hybrid.Stats()
+
+	for _, path := range []string{"/empty", "/spa", "/lib"} {
+		scraped, err = hybrid.Scrape(ts.URL + path)
+		if assert.NoError(t, err, path) {
+			assert.True(t, hybrid.CanRenderPage(), path)
+			assert.Equal(t, fmt.Sprintf("scrape %d", browser.scrapes), scraped.HTML, "The rendered HTML should be kept")
+			assert.Equal(t, "static", scraped.Cookies["session"], "Static data should be merged")
+		}
+	}
+	assert.Contains(t, scraped.Meta["generator"], "Static")
+	assert.Equal(t, 1, browser.inits, "The browser should be launched once")
+	values, err := hybrid.EvalJSProperties([]string{"a.b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", values["a.b"].Value)
+	}
+
+	assert.Equal(t, HybridStats{Pages: 4, Escalated: 3, Reasons: map[string]int{
+		EscalationEmptyBody: 1, EscalationSPAMarkers: 1, EscalationTechnologies: 1,
+	}}, hybrid.Stats())
+	assert.Equal(t, HybridStats{Pages: 3, Escalated: 3, Reasons: map[string]int{
+		EscalationEmptyBody: 1, EscalationSPAMarkers: 1, EscalationTechnologies: 1,
+	}}, hybrid.Stats().Since(before))
+}
+
+// dnsAnswer is a DNS response to query with the given answer and authority
+// records, whose names point to the question
+func dnsAnswer(query []byte, answers [][]byte, authority [][]byte) []byte {
+	response := append([]byte(nil), query...)
+	response[2] |= 0x80
+	binary.BigEndian.PutUint16(response[6:], uint16(len(answers)))
+	binary.BigEndian.PutUint16(response[8:], uint16(len(authority)))
+	for _, record := range append(answers, authority...) {
+		response = append(response, 0xC0, 12)
+		response = append(response, record...)
+	}
+	return response
+}
+
+// dnsRR is a record of type rtype with rdata, without its name
+func dnsRR(rtype uint16, rdata []byte) []byte {
+	rr := []byte{byte(rtype >> 8), byte(rtype), 0, 1, 0, 0, 1, 0, byte(len(rdata) >> 8), byte(len(rdata))}
+	return append(rr, rdata...)
+}
+
+func TestQueryDNS(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			qtype := binary.BigEndian.Uint16(query[n-4:])
+			var response []byte
+			switch qtype {
+			case dnsTypeCNAME:
+				// www.example.com. -> cdn.example.net.
+				response = dnsAnswer(query, [][]byte{dnsRR(dnsTypeCNAME, []byte("\x03cdn\x07example\x03net\x00"))}, nil)
+			case dnsTypeCAA:
+				response = dnsAnswer(query, [][]byte{dnsRR(dnsTypeCAA, []byte("\x00\x05issueletsencrypt.org"))}, nil)
+			case dnsTypeSOA:
+				soa := append([]byte("\x03ns1\xC0\x10\x0Ahostmaster\xC0\x10"), 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0, 5)
+				response = dnsAnswer(query, nil, [][]byte{dnsRR(dnsTypeSOA, soa)})
+			default:
+				response = append([]byte(nil), query...)
+				response[3] |= 3
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+	server := conn.LocalAddr().String()
+
+	records, err := queryDNS(server, time.Second, "www.example.com", dnsTypeCNAME)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []dnsRecord{{Name: "www.example.com", Type: dnsTypeCNAME, Data: "cdn.example.net"}}, records)
+	}
+	resolver := NewNetResolver(server, time.Second)
+	values, err := resolver.Lookup("www.example.com", "CNAME")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cdn.example.net"}, values)
+	values, _ = resolver.Lookup("www.example.com", "CAA")
+	assert.Equal(t, []string{`0 issue "letsencrypt.org"`}, values)
+	values, _ = resolver.Lookup("www.example.com", "SOA")
+	assert.Equal(t, []string{"ns1.example.com hostmaster.example.com 1 2 3 4 5"}, values,
+		"SOA records of the authority section should be returned")
+	_, err = resolver.Lookup("www.example.com", "HINFO")
+	assert.Equal(t, ErrUnknownRecordType, err)
+	records, err = queryDNS(server, time.Second, "www.example.com", 1)
+	assert.NoError(t, err)
+	assert.Empty(t, records, "Unknown names should have no records")
+	_, err = queryDNS(server, time.Second, "a..b", dnsTypeCAA)
+	assert.Error(t, err)
+
+	_, _, err = readDNSName([]byte{0xC0, 0}, 0)
+	assert.Error(t, err, "Compression loops should be rejected")
+
+	system := NewNetResolver("", time.Second)
+	for _, recordType := range []string{"CAA", "SOA"} {
+		values, err = system.Lookup("www.example.com", recordType)
+		assert.NoError(t, err)
+		assert.Empty(t, values, "The system resolver has no %s lookup", recordType)
+	}
+	values, err = system.Lookup("localhost", "CNAME")
+	assert.NoError(t, err)
+	assert.Empty(t, values, "Names without CNAME should have no records")
+}
+
+func TestParseTXT(t *testing.T) {
+	txt := []string{
+		"v=spf1 ip4:192.0.2.0/24 include:_spf.google.com ~include:Mailgun.org -include:spf.protection.outlook.com ?include:sendgrid.net +include:servers.mcsv.net redirect=spf.example.net -all",
+		"google-site-verification=abc123",
+		"MS=ms12345",
+		"atlassian-domain-verification=xyz",
+		"some other record",
+	}
+	assert.Equal(t, []string{"_spf.google.com", "mailgun.org", "spf.protection.outlook.com", "sendgrid.net", "servers.mcsv.net", "spf.example.net"}, parseSPF(txt))
+	assert.Equal(t, []string{"google-site-verification", "ms", "atlassian-domain-verification"}, parseVerifications(txt))
+	assert.Equal(t, []string{"v=DMARC1", "p=reject", "rua=mailto:reports@dmarc.example.net"},
+		parseDMARC([]string{"v=DMARC1; p=reject; rua=mailto:reports@dmarc.example.net;", "unrelated"}))
+}
+
+func TestCollyTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+	scraperTest := &CollyScraper{TimeoutSeconds: 3}
+	if !assert.NoError(t, scraperTest.Init()) {
+		return
+	}
+	scraped, err := scraperTest.Scrape(ts.URL)
+	if assert.NoError(t, err) && assert.NotNil(t, scraped.URLs.TLS) {
+		scrapedTLS := scraped.URLs.TLS
+		assert.Equal(t, "TLS 1.3", scrapedTLS.Version)
+		assert.Regexp(t, "^TLS_", scrapedTLS.CipherSuite)
+		if assert.Len(t, scrapedTLS.Certificates, 1) {
+			leaf := scrapedTLS.Certificates[0]
+			assert.Equal(t, extractCertificate(ts.Certificate()), leaf)
+			assert.Subset(t, leaf.SANs, []string{"example.com", "127.0.0.1"})
+			assert.Contains(t, leaf.Subject, "O=Acme Co")
+			assert.NotEmpty(t, leaf.KeyType)
+			assert.NotEmpty(t, leaf.SignatureAlgorithm)
+		}
+	}
+
+	chain := []string{base64.StdEncoding.EncodeToString(ts.Certificate().Raw), "invalid"}
+	certs := parseCertificates(chain)
+	if assert.Len(t, certs, 1, "Parsing should stop at the first invalid certificate") {
+		assert.Equal(t, ts.Certificate().Raw, certs[0].Raw)
+	}
+}
+
+func TestIANACipherSuite(t *testing.T) {
+	suites := map[[3]string]string{
+		{"", "AES_128_GCM", ""}:                   "TLS_AES_128_GCM_SHA256",
+		{"", "AES_256_GCM", ""}:                   "TLS_AES_256_GCM_SHA384",
+		{"", "CHACHA20_POLY1305", ""}:             "TLS_CHACHA20_POLY1305_SHA256",
+		{"ECDHE_RSA", "AES_128_GCM", ""}:          "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		{"ECDHE_ECDSA", "AES_256_GCM", ""}:        "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+		{"ECDHE_RSA", "AES_128_CBC", "HMAC-SHA1"}: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+		{"RSA", "AES_128_CBC", "HMAC-SHA256"}:     "TLS_RSA_WITH_AES_128_CBC_SHA256",
+		{"ECDHE_RSA", "", ""}:                     "",
+	}
+	for details, suite := range suites {
+		assert.Equal(t, suite, ianaCipherSuite(details[0], details[1], details[2]), details)
+	}
+	// The names of the Go client and of the browser should be the same
+	assert.Equal(t, tls.CipherSuiteName(tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA), ianaCipherSuite("ECDHE_RSA", "AES_128_CBC", "HMAC-SHA1"))
+	assert.Equal(t, tls.CipherSuiteName(tls.TLS_AES_256_GCM_SHA384), ianaCipherSuite("", "AES_256_GCM", ""))
+}
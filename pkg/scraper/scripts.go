@@ -0,0 +1,89 @@
+package scraper
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const scriptWorkers = 4
+
+// ScrapedScript is the content of a script of the page, URL is empty for
+// inline scripts
+type ScrapedScript struct {
+	URL     string `json:"url,omitempty"`
+	Content string `json:"content"`
+}
+
+// ScriptLoader downloads the external scripts of the scraped pages, first
+// party and third party, so that their contents can be matched. At most
+// MaxCount scripts of MaxBytes each are downloaded per page.
+type ScriptLoader struct {
+	Fetcher  *Fetcher
+	MaxCount int
+	MaxBytes int64
+}
+
+// Load adds the inline scripts and the contents of the external scripts of
+// scraped to its ScriptContents
+func (l *ScriptLoader) Load(scraped *ScrapedData, inline []string) {
+	for _, content := range inline {
+		if strings.TrimSpace(content) != "" {
+			scraped.ScriptContents = append(scraped.ScriptContents, ScrapedScript{Content: content})
+		}
+	}
+
+	base, _ := url.Parse(scraped.URLs.URL)
+	var scriptURLs []string
+	seen := make(map[string]struct{})
+	for _, src := range scraped.Scripts {
+		if len(scriptURLs) >= l.MaxCount {
+			break
+		}
+		u, err := url.Parse(strings.TrimSpace(src))
+		if err != nil || src == "" {
+			continue
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		if _, ok := seen[u.String()]; !ok {
+			seen[u.String()] = struct{}{}
+			scriptURLs = append(scriptURLs, u.String())
+		}
+	}
+
+	contents := make([]string, len(scriptURLs))
+	workers := make(chan struct{}, scriptWorkers)
+	var wg sync.WaitGroup
+	for i, scriptURL := range scriptURLs {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, scriptURL string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			resource, err := l.Fetcher.Fetch(scriptURL, l.MaxBytes)
+			if err == nil && resource.Status != http.StatusOK {
+				err = errHTTPStatus(resource.Status)
+			}
+			if err != nil {
+				log.Debugf("Couldn't download script %s : %v", scriptURL, err)
+				return
+			}
+			contents[i] = string(resource.Body)
+		}(i, scriptURL)
+	}
+	wg.Wait()
+
+	for i, scriptURL := range scriptURLs {
+		if contents[i] != "" {
+			scraped.ScriptContents = append(scraped.ScriptContents, ScrapedScript{URL: scriptURL, Content: contents[i]})
+		}
+	}
+}
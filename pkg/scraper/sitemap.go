@@ -0,0 +1,106 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxSitemapSize  = 50 * 1024 * 1024
+	maxSitemapFiles = 25
+)
+
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// SitemapURLs returns up to maxURLs page URLs of the site of siteURL listed
+// in its sitemaps : the Sitemap lines of robots.txt, read through robots
+// when not nil, and /sitemap.xml. Sitemap indexes and gzipped sitemaps are
+// followed.
+func (f *Fetcher) SitemapURLs(siteURL string, robots *RobotsPolicy, maxURLs int) []string {
+	site, err := url.Parse(siteURL)
+	if err != nil {
+		return nil
+	}
+	root := site.Scheme + "://" + site.Host
+
+	var queue []string
+	if robots != nil {
+		queue = append(queue, robots.Sitemaps(site)...)
+	}
+	queue = append(queue, root+"/sitemap.xml")
+
+	var pages []string
+	seenSitemaps := make(map[string]struct{})
+	seenPages := make(map[string]struct{})
+	for len(queue) > 0 && len(seenSitemaps) < maxSitemapFiles && len(pages) < maxURLs {
+		sitemapURL := strings.TrimSpace(queue[0])
+		queue = queue[1:]
+		if _, seen := seenSitemaps[sitemapURL]; seen {
+			continue
+		}
+		seenSitemaps[sitemapURL] = struct{}{}
+
+		sitemap, err := f.fetchSitemap(sitemapURL)
+		if err != nil {
+			log.Infof("Couldn't read sitemap %s : %v", sitemapURL, err)
+			continue
+		}
+		for _, child := range sitemap.Sitemaps {
+			queue = append(queue, child.Loc)
+		}
+		for _, page := range sitemap.URLs {
+			loc := strings.TrimSpace(page.Loc)
+			pageURL, err := url.Parse(loc)
+			if err != nil || pageURL.Host != site.Host {
+				continue
+			}
+			if _, seen := seenPages[loc]; !seen && len(pages) < maxURLs {
+				seenPages[loc] = struct{}{}
+				pages = append(pages, loc)
+			}
+		}
+	}
+	return pages
+}
+
+func (f *Fetcher) fetchSitemap(sitemapURL string) (*sitemapXML, error) {
+	resource, err := f.Fetch(sitemapURL, maxSitemapSize)
+	if err != nil {
+		return nil, err
+	}
+	if resource.Status != 200 {
+		return nil, errHTTPStatus(resource.Status)
+	}
+	body := resource.Body
+	// Gzipped sitemaps are served either as .xml.gz files or with a gzip content type
+	if len(body) > 1 && body[0] == 0x1f && body[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if body, err = ioutil.ReadAll(io.LimitReader(reader, maxSitemapSize)); err != nil {
+			return nil, err
+		}
+	}
+	sitemap := &sitemapXML{}
+	if err := xml.Unmarshal(body, sitemap); err != nil {
+		return nil, err
+	}
+	return sitemap, nil
+}
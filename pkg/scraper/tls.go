@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScrapedCertificate is a certificate presented by the server
+type ScrapedCertificate struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SANs               []string  `json:"sans,omitempty"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	KeyType            string    `json:"keyType,omitempty"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm,omitempty"`
+}
+
+// ScrapedTLS is the TLS connection of the page : the negotiated version
+// (TLS 1.3), cipher suite (IANA name) and application protocol, and the
+// certificate chain, leaf first
+type ScrapedTLS struct {
+	Version      string               `json:"version,omitempty"`
+	CipherSuite  string               `json:"cipherSuite,omitempty"`
+	ALPN         string               `json:"alpn,omitempty"`
+	Certificates []ScrapedCertificate `json:"certificates,omitempty"`
+}
+
+// tlsVersions are the names of the TLS versions, as Chrome reports them
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// extractTLS returns the TLS details of a connection of the Go client
+func extractTLS(state *tls.ConnectionState) *ScrapedTLS {
+	scrapedTLS := &ScrapedTLS{
+		Version:     tlsVersions[state.Version],
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	for _, cert := range state.PeerCertificates {
+		scrapedTLS.Certificates = append(scrapedTLS.Certificates, extractCertificate(cert))
+	}
+	return scrapedTLS
+}
+
+// extractCertificate returns the details of cert
+func extractCertificate(cert *x509.Certificate) ScrapedCertificate {
+	scraped := ScrapedCertificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SANs:               append([]string(nil), cert.DNSNames...),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           cert.NotAfter.UTC(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+	}
+	for _, ip := range cert.IPAddresses {
+		scraped.SANs = append(scraped.SANs, ip.String())
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		scraped.KeyType = fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		scraped.KeyType = "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		scraped.KeyType = "Ed25519"
+	}
+	return scraped
+}
+
+// parseCertificates parses a chain of base64 DER certificates, as returned
+// by the browser. It stops at the first invalid one.
+func parseCertificates(chain []string) (certs []*x509.Certificate) {
+	for _, encoded := range chain {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			break
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// ianaCipherSuite returns the IANA name of the cipher suite reported by
+// Chrome as its key exchange (empty in TLS 1.3), cipher and MAC (empty for
+// AEAD ciphers), such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+func ianaCipherSuite(keyExchange, cipher, mac string) string {
+	if cipher == "" {
+		return ""
+	}
+	hash := "SHA256"
+	switch {
+	case mac == "HMAC-SHA1":
+		hash = "SHA"
+	case mac != "":
+		hash = strings.TrimPrefix(mac, "HMAC-")
+	case strings.Contains(cipher, "256_GCM"):
+		hash = "SHA384"
+	}
+	if keyExchange == "" {
+		return "TLS_" + cipher + "_" + hash
+	}
+	return "TLS_" + keyExchange + "_WITH_" + cipher + "_" + hash
+}
@@ -0,0 +1,164 @@
+// Package urlnorm normalizes URLs so that the different spellings of a page
+// (case, default ports, percent-encoding, dot segments, IDN hosts, ...)
+// share a single form
+package urlnorm
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ignored are the characters browsers strip from URLs in HTML attributes
+var ignored = strings.NewReplacer("\t", "", "\n", "", "\r", "")
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// Normalize resolves rawURL against base (which can be nil) and returns its
+// normalized form :
+//   - lower case scheme and host, IDN host in punycode, no trailing dot
+//   - no default port, no fragment
+//   - dot segments removed, no trailing slash
+//   - percent-encoding of unreserved characters decoded, other escapes upper cased
+//   - query parameters sorted, empty ones removed
+//
+// URLs without host (mailto:, javascript:, relative URLs without base) are
+// only resolved.
+func Normalize(base *url.URL, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(ignored.Replace(rawURL)))
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Opaque != "" || u.Host == "" {
+		return u, nil
+	}
+
+	if u.Host, err = normalizeHost(u.Scheme, u.Host); err != nil {
+		return nil, err
+	}
+
+	// Resolving an empty reference removes the dot segments
+	query := u.RawQuery
+	u = u.ResolveReference(&url.URL{})
+	escapedPath := strings.TrimRight(normalizeEscapes(u.EscapedPath()), "/")
+	if u.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return nil, err
+	}
+	u.RawPath = escapedPath
+	u.RawQuery = normalizeQuery(query)
+	u.ForceQuery = false
+	return u, nil
+}
+
+// normalizeHost lower cases host, converts it to ASCII and removes the port
+// when it is the default one of scheme
+func normalizeHost(scheme, host string) (string, error) {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	} else if strings.HasSuffix(host, ":") {
+		hostname = strings.TrimSuffix(host, ":")
+	}
+	hostname = strings.TrimSuffix(strings.ToLower(strings.Trim(hostname, "[]")), ".")
+	if strings.Contains(hostname, ":") {
+		hostname = "[" + hostname + "]"
+	} else {
+		var err error
+		if hostname, err = ToASCII(hostname); err != nil {
+			return "", err
+		}
+	}
+	if port == "" || port == defaultPorts[scheme] {
+		return hostname, nil
+	}
+	return hostname + ":" + port, nil
+}
+
+// hostProfile maps host names as browsers do, allowing the "_" and "--" of
+// labels in use such as _dmarc or r3---sn-abc
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false), idna.CheckHyphens(false))
+
+// ToASCII converts the labels of an internationalized host name to punycode
+func ToASCII(host string) (string, error) {
+	return hostProfile.ToASCII(host)
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// mustEscape tells whether c cannot appear unescaped in a path or query
+func mustEscape(c byte) bool {
+	return c <= ' ' || c >= 0x7f || strings.IndexByte("\"<>\\^`{|}", c) >= 0
+}
+
+// normalizeEscapes decodes the escaped unreserved characters, upper cases
+// the other escapes and escapes the characters which must be
+func normalizeEscapes(s string) string {
+	const upperHex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(upperHex[decoded>>4])
+				b.WriteByte(upperHex[decoded&15])
+			}
+			i += 2
+		case c == '%' || mustEscape(c):
+			b.WriteByte('%')
+			b.WriteByte(upperHex[c>>4])
+			b.WriteByte(upperHex[c&15])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// normalizeQuery sorts the parameters of the raw query and drops the empty ones
+func normalizeQuery(query string) string {
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		if param != "" {
+			params = append(params, normalizeEscapes(param))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
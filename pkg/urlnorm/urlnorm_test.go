@@ -0,0 +1,98 @@
+package urlnorm
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"пример.испытание", "xn--e1afmkfd.xn--80akhbyknj4f"},
+		{"例え。テスト", "xn--r8jz45g.xn--zckzah"},
+		{"xn--mnchen-3ya.de", "xn--mnchen-3ya.de"},
+		{"_dmarc.example.com", "_dmarc.example.com"},
+		{"r3---sn-abc.googlevideo.com", "r3---sn-abc.googlevideo.com"},
+	}
+	for _, tt := range tests {
+		got, err := ToASCII(tt.host)
+		if assert.NoError(t, err, tt.host) {
+			assert.Equal(t, tt.want, got, tt.host)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	base, _ := url.Parse("https://www.example.com:443/blog/post/index.html?x=1#top")
+	tests := []struct {
+		name string
+		base *url.URL
+		url  string
+		want string
+	}{
+		{"already normalized", nil, "https://example.com/a/b", "https://example.com/a/b"},
+		{"case of scheme and host", nil, "HTTPS://WWW.Example.COM/Path", "https://www.example.com/Path"},
+		{"default http port", nil, "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", nil, "https://example.com:443/a", "https://example.com/a"},
+		{"empty port", nil, "https://example.com:/a", "https://example.com/a"},
+		{"other port kept", nil, "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"http port on https kept", nil, "https://example.com:80/a", "https://example.com:80/a"},
+		{"trailing dot of host", nil, "https://example.com./a", "https://example.com/a"},
+		{"root", nil, "https://example.com/", "https://example.com"},
+		{"trailing slash", nil, "https://example.com/a/b/", "https://example.com/a/b"},
+		{"fragment", nil, "https://example.com/a#section", "https://example.com/a"},
+		{"dot segments", nil, "https://example.com/a/./b/../c", "https://example.com/a/c"},
+		{"dot segments above root", nil, "https://example.com/../../a", "https://example.com/a"},
+		{"unreserved escapes decoded", nil, "https://example.com/%7Euser/%41%62c", "https://example.com/~user/Abc"},
+		{"reserved escapes upper cased", nil, "https://example.com/a%2fb%3f", "https://example.com/a%2Fb%3F"},
+		{"space escaped", nil, "https://example.com/a b", "https://example.com/a%20b"},
+		{"unicode path escaped", nil, "https://example.com/café", "https://example.com/caf%C3%A9"},
+		{"unicode path escape case", nil, "https://example.com/caf%c3%a9", "https://example.com/caf%C3%A9"},
+		{"query sorted", nil, "https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"empty query parameters", nil, "https://example.com/a?&a=1&&", "https://example.com/a?a=1"},
+		{"empty query", nil, "https://example.com/a?", "https://example.com/a"},
+		{"query escapes", nil, "https://example.com/a?q=%7e%2f", "https://example.com/a?q=~%2F"},
+		{"IDN host", nil, "https://Bücher.example/", "https://xn--bcher-kva.example"},
+		{"IDN host with port", nil, "http://münchen.de:8080/", "http://xn--mnchen-3ya.de:8080"},
+		{"IPv6 host", nil, "http://[::1]:80/a", "http://[::1]/a"},
+		{"IPv6 host with port", nil, "http://[::1]:8080/a", "http://[::1]:8080/a"},
+		{"userinfo kept", nil, "https://user@example.com/", "https://user@example.com"},
+		{"tabs and newlines stripped", nil, " https://example.com/a\n\t?x=1\r\n&y=2 ", "https://example.com/a?x=1&y=2"},
+		{"relative path", base, "other.html", "https://www.example.com/blog/post/other.html"},
+		{"parent path", base, "../archive/", "https://www.example.com/blog/archive"},
+		{"absolute path", base, "/about", "https://www.example.com/about"},
+		{"protocol relative", base, "//cdn.example.com/x", "https://cdn.example.com/x"},
+		{"query only", base, "?page=2", "https://www.example.com/blog/post/index.html?page=2"},
+		{"fragment only", base, "#comments", "https://www.example.com/blog/post/index.html?x=1"},
+		{"empty reference", base, "", "https://www.example.com/blog/post/index.html?x=1"},
+		{"other host keeps its port", base, "https://www.example.com:8080/a", "https://www.example.com:8080/a"},
+		{"mailto", base, "mailto:Me@Example.com", "mailto:Me@Example.com"},
+		{"javascript", base, "javascript:void(0)", "javascript:void(0)"},
+		{"relative without base", nil, "a/b", "a/b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.base, tt.url)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got.String())
+			}
+			// Normalizing is idempotent
+			again, err := Normalize(nil, got.String())
+			if assert.NoError(t, err) {
+				assert.Equal(t, got.String(), again.String())
+			}
+		})
+	}
+
+	_, err := Normalize(nil, "http://[::1/a")
+	assert.Error(t, err, "Invalid URLs should fail")
+}
@@ -0,0 +1,87 @@
+package vuln
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompareVersions compares two version strings segment by segment and
+// returns -1, 0 or 1. Numeric segments are compared as numbers, other
+// segments lexically, and missing trailing zero segments are ignored
+// ("1.2" == "1.2.0"). A pre-release suffix sorts before the release
+// ("1.2.0-rc1" < "1.2.0").
+func CompareVersions(a, b string) int {
+	segmentsA, segmentsB := splitVersion(a), splitVersion(b)
+	for i := 0; i < len(segmentsA) || i < len(segmentsB); i++ {
+		var segA, segB string
+		if i < len(segmentsA) {
+			segA = segmentsA[i]
+		}
+		if i < len(segmentsB) {
+			segB = segmentsB[i]
+		}
+		if res := compareSegments(segA, segB); res != 0 {
+			return res
+		}
+	}
+	return 0
+}
+
+func compareSegments(a, b string) int {
+	numA, errA := strconv.ParseUint(a, 10, 64)
+	numB, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case a == b:
+		return 0
+	case errA == nil && errB == nil:
+		if numA < numB {
+			return -1
+		} else if numA > numB {
+			return 1
+		}
+		return 0
+	case a == "":
+		// 1.2 vs 1.2.0 are equal, 1.2 vs 1.2-beta is a release vs a pre-release
+		if errB == nil && numB == 0 {
+			return 0
+		} else if errB == nil {
+			return -1
+		}
+		return 1
+	case b == "":
+		return -compareSegments(b, a)
+	case errA == nil:
+		// Numeric segments sort after textual ones (1.2.0 > 1.2.rc)
+		return 1
+	case errB == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// splitVersion splits a version on separators and on digit/letter boundaries
+func splitVersion(version string) (segments []string) {
+	var current strings.Builder
+	lastDigit := false
+	for _, r := range strings.ToLower(strings.TrimPrefix(strings.TrimSpace(version), "v")) {
+		isDigit := unicode.IsDigit(r)
+		if !isDigit && !unicode.IsLetter(r) {
+			if current.Len() > 0 {
+				segments = append(segments, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		if current.Len() > 0 && isDigit != lastDigit {
+			segments = append(segments, current.String())
+			current.Reset()
+		}
+		current.WriteRune(r)
+		lastDigit = isDigit
+	}
+	if current.Len() > 0 {
+		segments = append(segments, current.String())
+	}
+	return segments
+}
@@ -0,0 +1,386 @@
+package vuln
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Vulnerability is a CVE affecting a detected technology version
+type Vulnerability struct {
+	ID       string  `json:"id"`
+	CVSS     float64 `json:"cvss,omitempty"`
+	Severity string  `json:"severity,omitempty"`
+}
+
+// versionRange is the affected version span of a vulnerable CPE match
+type versionRange struct {
+	Version        string `json:"v,omitempty"`
+	StartIncluding string `json:"si,omitempty"`
+	StartExcluding string `json:"se,omitempty"`
+	EndIncluding   string `json:"ei,omitempty"`
+	EndExcluding   string `json:"ee,omitempty"`
+}
+
+// entry is a vulnerability with the version ranges of one product it affects
+type entry struct {
+	Vulnerability
+	Ranges []versionRange `json:"ranges"`
+}
+
+// Database holds vulnerabilities indexed by "part:vendor:product"
+type Database struct {
+	Products map[string][]*entry `json:"products"`
+}
+
+// NVD JSON 1.1 feed (nvdcve-1.1-*.json)
+type nvdFeed11 struct {
+	Items []struct {
+		CVE struct {
+			Meta struct {
+				ID string `json:"ID"`
+			} `json:"CVE_data_meta"`
+		} `json:"cve"`
+		Configurations struct {
+			Nodes []nvdNode11 `json:"nodes"`
+		} `json:"configurations"`
+		Impact struct {
+			V3 struct {
+				CVSS struct {
+					BaseScore    float64 `json:"baseScore"`
+					BaseSeverity string  `json:"baseSeverity"`
+				} `json:"cvssV3"`
+			} `json:"baseMetricV3"`
+			V2 struct {
+				CVSS struct {
+					BaseScore float64 `json:"baseScore"`
+				} `json:"cvssV2"`
+				Severity string `json:"severity"`
+			} `json:"baseMetricV2"`
+		} `json:"impact"`
+	} `json:"CVE_Items"`
+}
+
+type nvdNode11 struct {
+	Children []nvdNode11 `json:"children"`
+	CPEMatch []struct {
+		Vulnerable            bool   `json:"vulnerable"`
+		CPE23URI              string `json:"cpe23Uri"`
+		VersionStartIncluding string `json:"versionStartIncluding"`
+		VersionStartExcluding string `json:"versionStartExcluding"`
+		VersionEndIncluding   string `json:"versionEndIncluding"`
+		VersionEndExcluding   string `json:"versionEndExcluding"`
+	} `json:"cpe_match"`
+}
+
+// NVD API 2.0 response, as stored by the feed downloaders
+type nvdFeed20 struct {
+	Vulnerabilities []struct {
+		CVE struct {
+			ID      string `json:"id"`
+			Metrics map[string][]struct {
+				CVSSData struct {
+					BaseScore    float64 `json:"baseScore"`
+					BaseSeverity string  `json:"baseSeverity"`
+				} `json:"cvssData"`
+				BaseSeverity string `json:"baseSeverity"`
+			} `json:"metrics"`
+			Configurations []struct {
+				Nodes []struct {
+					CPEMatch []struct {
+						Vulnerable            bool   `json:"vulnerable"`
+						Criteria              string `json:"criteria"`
+						VersionStartIncluding string `json:"versionStartIncluding"`
+						VersionStartExcluding string `json:"versionStartExcluding"`
+						VersionEndIncluding   string `json:"versionEndIncluding"`
+						VersionEndExcluding   string `json:"versionEndExcluding"`
+					} `json:"cpeMatch"`
+				} `json:"nodes"`
+			} `json:"configurations"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+// NewDatabase returns an empty vulnerability database
+func NewDatabase() *Database {
+	return &Database{Products: make(map[string][]*entry)}
+}
+
+// Load reads a NVD JSON feed (1.1 or 2.0), a compact index written by
+// WriteIndex, or a directory of those. Gzipped files are supported.
+func Load(path string) (*Database, error) {
+	db := NewDatabase()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return db, db.loadFile(path)
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !(strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")) {
+			continue
+		}
+		if err := db.loadFile(filepath.Join(path, name)); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (db *Database) loadFile(path string) error {
+	log.Infof("Loading vulnerability feed %s", path)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(content) > 1 && content[0] == 0x1f && content[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if content, err = ioutil.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+
+	probe := make(map[string]jsoniter.RawMessage)
+	if err := json.Unmarshal(content, &probe); err != nil {
+		return err
+	}
+	switch {
+	case probe["CVE_Items"] != nil:
+		feed := &nvdFeed11{}
+		if err := json.Unmarshal(content, feed); err != nil {
+			return err
+		}
+		db.addFeed11(feed)
+	case probe["vulnerabilities"] != nil:
+		feed := &nvdFeed20{}
+		if err := json.Unmarshal(content, feed); err != nil {
+			return err
+		}
+		db.addFeed20(feed)
+	case probe["products"] != nil:
+		index := NewDatabase()
+		if err := json.Unmarshal(content, index); err != nil {
+			return err
+		}
+		for product, entries := range index.Products {
+			for _, e := range entries {
+				db.addEntry(product, e)
+			}
+		}
+	default:
+		return errors.New("UnknownFeedFormat")
+	}
+	return nil
+}
+
+func (db *Database) addFeed11(feed *nvdFeed11) {
+	var walk func(nodes []nvdNode11, vuln Vulnerability)
+	walk = func(nodes []nvdNode11, vuln Vulnerability) {
+		for _, node := range nodes {
+			for _, match := range node.CPEMatch {
+				if match.Vulnerable {
+					db.add(vuln, match.CPE23URI, versionRange{
+						StartIncluding: match.VersionStartIncluding,
+						StartExcluding: match.VersionStartExcluding,
+						EndIncluding:   match.VersionEndIncluding,
+						EndExcluding:   match.VersionEndExcluding,
+					})
+				}
+			}
+			walk(node.Children, vuln)
+		}
+	}
+	for _, item := range feed.Items {
+		vuln := Vulnerability{ID: item.CVE.Meta.ID}
+		if item.Impact.V3.CVSS.BaseScore > 0 {
+			vuln.CVSS = item.Impact.V3.CVSS.BaseScore
+			vuln.Severity = item.Impact.V3.CVSS.BaseSeverity
+		} else {
+			vuln.CVSS = item.Impact.V2.CVSS.BaseScore
+			vuln.Severity = item.Impact.V2.Severity
+		}
+		walk(item.Configurations.Nodes, vuln)
+	}
+}
+
+func (db *Database) addFeed20(feed *nvdFeed20) {
+	for _, item := range feed.Vulnerabilities {
+		vuln := Vulnerability{ID: item.CVE.ID}
+		// Prefer the most recent CVSS version available
+		for _, metric := range []string{"cvssMetricV40", "cvssMetricV31", "cvssMetricV30", "cvssMetricV2"} {
+			if scores := item.CVE.Metrics[metric]; len(scores) > 0 {
+				vuln.CVSS = scores[0].CVSSData.BaseScore
+				vuln.Severity = scores[0].CVSSData.BaseSeverity
+				if vuln.Severity == "" {
+					vuln.Severity = scores[0].BaseSeverity
+				}
+				break
+			}
+		}
+		for _, configuration := range item.CVE.Configurations {
+			for _, node := range configuration.Nodes {
+				for _, match := range node.CPEMatch {
+					if match.Vulnerable {
+						db.add(vuln, match.Criteria, versionRange{
+							StartIncluding: match.VersionStartIncluding,
+							StartExcluding: match.VersionStartExcluding,
+							EndIncluding:   match.VersionEndIncluding,
+							EndExcluding:   match.VersionEndExcluding,
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// add records a vulnerable cpe match, merging ranges of the same CVE
+func (db *Database) add(vuln Vulnerability, cpe string, rng versionRange) {
+	product, version, ok := parseCPE(cpe)
+	if !ok {
+		return
+	}
+	if version != "*" && version != "-" {
+		rng.Version = version
+	}
+	db.addEntry(product, &entry{vuln, []versionRange{rng}})
+}
+
+// addEntry records e for product, merging its ranges into the entry of the
+// same CVE when the product already has one, so that overlapping feeds and
+// indexes don't duplicate vulnerabilities
+func (db *Database) addEntry(product string, e *entry) {
+	for _, known := range db.Products[product] {
+		if known.ID != e.ID {
+			continue
+		}
+		for _, rng := range e.Ranges {
+			if !hasRange(known.Ranges, rng) {
+				known.Ranges = append(known.Ranges, rng)
+			}
+		}
+		return
+	}
+	db.Products[product] = append(db.Products[product], e)
+}
+
+// hasRange tells whether ranges hold rng
+func hasRange(ranges []versionRange, rng versionRange) bool {
+	for _, known := range ranges {
+		if known == rng {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteIndex stores the database as a compact gzipped index which can be
+// loaded back with Load
+func (db *Database) WriteIndex(path string) error {
+	content, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err = writer.Write(content); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Match returns the vulnerabilities affecting the given version of the
+// product identified by cpe, highest CVSS score first
+func (db *Database) Match(cpe string, version string) (res []Vulnerability) {
+	product, _, ok := parseCPE(cpe)
+	if !ok || version == "" {
+		return nil
+	}
+	for _, e := range db.Products[product] {
+		for _, rng := range e.Ranges {
+			if rng.contains(version) {
+				res = append(res, e.Vulnerability)
+				break
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].CVSS != res[j].CVSS {
+			return res[i].CVSS > res[j].CVSS
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+func (rng *versionRange) contains(version string) bool {
+	if rng.Version != "" {
+		return CompareVersions(version, rng.Version) == 0
+	}
+	if rng.StartIncluding == "" && rng.StartExcluding == "" && rng.EndIncluding == "" && rng.EndExcluding == "" {
+		// Every version of the product is affected
+		return true
+	}
+	if rng.StartIncluding != "" && CompareVersions(version, rng.StartIncluding) < 0 {
+		return false
+	}
+	if rng.StartExcluding != "" && CompareVersions(version, rng.StartExcluding) <= 0 {
+		return false
+	}
+	if rng.EndIncluding != "" && CompareVersions(version, rng.EndIncluding) > 0 {
+		return false
+	}
+	if rng.EndExcluding != "" && CompareVersions(version, rng.EndExcluding) >= 0 {
+		return false
+	}
+	return true
+}
+
+// parseCPE extracts the "part:vendor:product" key and the version (with its
+// update component, e.g. 2.0-beta9) from a CPE 2.2 URI
+// (cpe:/a:vendor:product:version) or a CPE 2.3 formatted string
+func parseCPE(cpe string) (product string, version string, ok bool) {
+	var parts []string
+	switch {
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		parts = strings.Split(strings.TrimPrefix(cpe, "cpe:2.3:"), ":")
+	case strings.HasPrefix(cpe, "cpe:/"):
+		parts = strings.Split(strings.TrimPrefix(cpe, "cpe:/"), ":")
+	default:
+		return "", "", false
+	}
+	if len(parts) < 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	version = "*"
+	if len(parts) > 3 && parts[3] != "" {
+		version = strings.ReplaceAll(parts[3], `\`, "")
+		if len(parts) > 4 && parts[4] != "" && parts[4] != "*" && parts[4] != "-" {
+			version += "-" + strings.ReplaceAll(parts[4], `\`, "")
+		}
+	}
+	return strings.ToLower(strings.Join(parts[:3], ":")), version, true
+}
@@ -0,0 +1,129 @@
+package vuln
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var feed11 = `{"CVE_data_type":"CVE","CVE_Items":[
+	{"cve":{"CVE_data_meta":{"ID":"CVE-2020-11022"}},
+	 "configurations":{"nodes":[{"operator":"OR","children":[],"cpe_match":[
+		{"vulnerable":true,"cpe23Uri":"cpe:2.3:a:jquery:jquery:*:*:*:*:*:*:*:*","versionStartIncluding":"1.2","versionEndExcluding":"3.5.0"}]}]},
+	 "impact":{"baseMetricV3":{"cvssV3":{"baseScore":6.1,"baseSeverity":"MEDIUM"}}}},
+	{"cve":{"CVE_data_meta":{"ID":"CVE-2019-11358"}},
+	 "configurations":{"nodes":[{"operator":"AND","children":[{"cpe_match":[
+		{"vulnerable":true,"cpe23Uri":"cpe:2.3:a:jquery:jquery:*:*:*:*:*:*:*:*","versionEndExcluding":"3.4.0"},
+		{"vulnerable":false,"cpe23Uri":"cpe:2.3:o:debian:debian_linux:8.0:*:*:*:*:*:*:*"}]}]}]},
+	 "impact":{"baseMetricV2":{"cvssV2":{"baseScore":4.3},"severity":"MEDIUM"}}}
+]}`
+
+var feed20 = `{"format":"NVD_CVE","vulnerabilities":[
+	{"cve":{"id":"CVE-2021-44228",
+	 "metrics":{"cvssMetricV31":[{"cvssData":{"baseScore":10.0,"baseSeverity":"CRITICAL"}}]},
+	 "configurations":[{"nodes":[{"cpeMatch":[
+		{"vulnerable":true,"criteria":"cpe:2.3:a:apache:log4j:*:*:*:*:*:*:*:*","versionStartIncluding":"2.0.1","versionEndExcluding":"2.12.2"},
+		{"vulnerable":true,"criteria":"cpe:2.3:a:apache:log4j:2.0:beta9:*:*:*:*:*:*"}]}]}]}}
+]}`
+
+func writeFile(t *testing.T, dir string, name string, content string, gzipped bool) string {
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if !assert.NoError(t, err, "Fixture creation error") {
+		t.FailNow()
+	}
+	defer file.Close()
+	if gzipped {
+		writer := gzip.NewWriter(file)
+		_, err = writer.Write([]byte(content))
+		assert.NoError(t, err, "Fixture write error")
+		assert.NoError(t, writer.Close(), "Fixture write error")
+	} else {
+		_, err = file.Write([]byte(content))
+		assert.NoError(t, err, "Fixture write error")
+	}
+	return path
+}
+
+func TestLoadAndMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowap-vuln")
+	if !assert.NoError(t, err, "TempDir error") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Load(writeFile(t, dir, "nvdcve-1.1-2020.json", feed11, false))
+	if assert.NoError(t, err, "NVD 1.1 feed should load") {
+		vulns := db.Match("cpe:/a:jquery:jquery", "3.3.1")
+		if assert.Len(t, vulns, 2, "jQuery 3.3.1 should have 2 vulnerabilities") {
+			assert.Equal(t, "CVE-2020-11022", vulns[0].ID, "Highest score first")
+			assert.Equal(t, 6.1, vulns[0].CVSS)
+			assert.Equal(t, "MEDIUM", vulns[1].Severity, "CVSS v2 severity should be used as fallback")
+		}
+		assert.Len(t, db.Match("cpe:/a:jquery:jquery", "3.4.1"), 1, "jQuery 3.4.1 should have 1 vulnerability")
+		assert.Empty(t, db.Match("cpe:/a:jquery:jquery", "3.5.1"), "jQuery 3.5.1 is not vulnerable")
+		assert.Len(t, db.Match("cpe:/a:jquery:jquery", "1.1"), 1, "jQuery 1.1 is before the CVE-2020-11022 range")
+		assert.Empty(t, db.Match("cpe:/a:jquery:jquery", ""), "Unknown version should not match")
+		assert.Empty(t, db.Match("cpe:/o:debian:debian_linux", "8.0"), "Non vulnerable matches should be ignored")
+		assert.Empty(t, db.Match("notacpe", "1.0"), "Bad CPE should not match")
+	}
+
+	writeFile(t, dir, "nvdcve-2.0-2021.json.gz", feed20, true)
+	writeFile(t, dir, "README.txt", "not a feed", false)
+	db, err = Load(dir)
+	if assert.NoError(t, err, "Feed directory should load") {
+		assert.Len(t, db.Match("cpe:/a:jquery:jquery", "3.3.1"), 2, "1.1 feed should be loaded from directory")
+		vulns := db.Match("cpe:2.3:a:apache:log4j:2.11:*:*:*:*:*:*:*", "2.11.0")
+		if assert.Len(t, vulns, 1, "Log4j 2.11.0 should be vulnerable") {
+			assert.Equal(t, "CRITICAL", vulns[0].Severity)
+		}
+		assert.Len(t, db.Match("cpe:/a:apache:log4j", "2.0-beta9"), 1, "Exact version should match")
+		assert.Empty(t, db.Match("cpe:/a:apache:log4j", "2.12.2"), "Log4j 2.12.2 is not vulnerable")
+
+		index := filepath.Join(dir, "index.json.gz")
+		assert.NoError(t, db.WriteIndex(index), "Index should be written")
+		indexed, err := Load(index)
+		if assert.NoError(t, err, "Index should load") {
+			assert.Equal(t, db.Match("cpe:/a:jquery:jquery", "3.3.1"), indexed.Match("cpe:/a:jquery:jquery", "3.3.1"))
+			assert.Equal(t, vulns, indexed.Match("cpe:/a:apache:log4j", "2.11.0"))
+		}
+		merged, err := Load(dir)
+		if assert.NoError(t, err, "Feeds and their index should load") {
+			assert.Equal(t, db.Products, merged.Products, "Vulnerabilities both in the feeds and the index should be merged")
+		}
+	}
+
+	_, err = Load(writeFile(t, dir, "bad.json", `{"this":"is","notgood"}`, false))
+	assert.Error(t, err, "Bad JSON should throw an error")
+	_, err = Load(writeFile(t, dir, "unknown.json", `{"this":"isgood"}`, false))
+	assert.Error(t, err, "Unknown format should throw an error")
+	_, err = Load(filepath.Join(dir, "doesnotexist.json"))
+	assert.Error(t, err, "Missing file should throw an error")
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2", "1.2", 0},
+		{"1.10", "1.9", 1},
+		{"1.2.3", "1.2.4", -1},
+		{"2.0", "10.0", -1},
+		{"1.2.0-rc1", "1.2.0", -1},
+		{"1.2.0-beta", "1.2.0-rc", -1},
+		{"1.2.0", "1.2.rc", 1},
+		{"2.0-beta9", "2.0", -1},
+		{"1.0.0a", "1.0.0b", -1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CompareVersions(tt.a, tt.b), "CompareVersions(%s, %s)", tt.a, tt.b)
+		assert.Equal(t, -tt.want, CompareVersions(tt.b, tt.a), "CompareVersions(%s, %s)", tt.b, tt.a)
+	}
+}